@@ -0,0 +1,173 @@
+package fastdownloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveWindow is how long throughput and round trip times are measured
+	// before the number of connections is adjusted.
+	adaptiveWindow = time.Second
+
+	// adaptiveHold is the number of windows the limit stays put after a
+	// connection was taken back before another one is tried.
+	adaptiveHold = 3
+
+	// adaptiveRTTSlack keeps the jitter of very short round trips, e.g. on a
+	// LAN, from passing for congestion.
+	adaptiveRTTSlack = 20 * time.Millisecond
+)
+
+// adaptiveLimit is an AIMD controller over the number of chunk requests of a
+// parallel download that run at once. Like TCP it starts with one connection
+// and doubles them while that raises the throughput. After that it adds a
+// connection per window while it pays off and takes it back when it doesn't.
+// Round trips growing to twice their minimum, a sign of queues building up
+// along the path, halve the connections.
+type adaptiveLimit struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	limit, max, active int
+
+	// changed is closed and replaced whenever a request slot may have become
+	// available.
+	changed chan struct{}
+
+	windowStart time.Time
+	windowBytes uint64
+	rttSum      time.Duration
+	rttCount    int
+
+	minRTT    time.Duration
+	prevRate  float64
+	slowStart bool
+	hold      int
+
+	// probedFrom is the limit before the last increase, or zero when the
+	// last window didn't raise it.
+	probedFrom int
+}
+
+func newAdaptiveLimit(max int, now func() time.Time) *adaptiveLimit {
+	return &adaptiveLimit{
+		now:         now,
+		limit:       1,
+		max:         max,
+		slowStart:   true,
+		changed:     make(chan struct{}),
+		windowStart: now(),
+	}
+}
+
+// acquire waits for a request slot.
+func (a *adaptiveLimit) acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+
+		if a.active < a.limit {
+			a.active++
+			a.mu.Unlock()
+
+			return nil
+		}
+
+		changed := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release gives a request slot back.
+func (a *adaptiveLimit) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.active--
+	a.notify()
+}
+
+// observeRTT records the time a range request took to be answered.
+func (a *adaptiveLimit) observeRTT(rtt time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rttSum += rtt
+	a.rttCount++
+}
+
+// Write counts the bytes received and adjusts the limit once a window is
+// over.
+func (a *adaptiveLimit) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.windowBytes += uint64(len(data))
+
+	now := a.now()
+
+	if elapsed := now.Sub(a.windowStart); elapsed >= adaptiveWindow {
+		var rtt time.Duration
+		if a.rttCount > 0 {
+			rtt = a.rttSum / time.Duration(a.rttCount)
+		}
+
+		a.adjust(float64(a.windowBytes)/elapsed.Seconds(), rtt)
+
+		a.windowStart, a.windowBytes, a.rttSum, a.rttCount = now, 0, 0, 0
+	}
+
+	return len(data), nil
+}
+
+// adjust sets the limit for the next window from the throughput and the mean
+// round trip time of the last one; rtt is zero when no request was answered.
+func (a *adaptiveLimit) adjust(rate float64, rtt time.Duration) {
+	if rtt > 0 && (a.minRTT == 0 || rtt < a.minRTT) {
+		a.minRTT = rtt
+	}
+
+	previous, probedFrom := a.limit, a.probedFrom
+	a.probedFrom = 0
+
+	switch {
+	case rtt > 2*a.minRTT && rtt-a.minRTT > adaptiveRTTSlack:
+		a.limit = max(1, a.limit/2)
+		a.slowStart, a.hold = false, adaptiveHold
+
+	case probedFrom > 0 && rate < a.prevRate*1.05:
+		// The added connections didn't add throughput.
+		a.limit = probedFrom
+		a.slowStart, a.hold = false, adaptiveHold
+
+	case a.hold > 0:
+		a.hold--
+
+	case a.limit < a.max:
+		a.probedFrom = a.limit
+
+		if a.slowStart {
+			a.limit = min(a.max, 2*a.limit)
+		} else {
+			a.limit++
+		}
+	}
+
+	a.prevRate = rate
+
+	if a.limit > previous {
+		a.notify()
+	}
+}
+
+func (a *adaptiveLimit) notify() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
@@ -0,0 +1,131 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// simulatedLink answers a window of n connections with the throughput and
+// round trip time of a link of capacity bytes per second, where each
+// connection alone gets perConnection. Beyond the capacity queues build up
+// and the round trip time climbs.
+type simulatedLink struct {
+	capacity, perConnection float64
+	baseRTT                 time.Duration
+}
+
+func (l simulatedLink) window(n int) (float64, time.Duration) {
+	offered := float64(n) * l.perConnection
+
+	if offered <= l.capacity {
+		return offered, l.baseRTT
+	}
+
+	return l.capacity, time.Duration(float64(l.baseRTT) * (1 + 2*(offered/l.capacity-1)))
+}
+
+func TestAdaptiveLimitSimulation(t *testing.T) {
+	a := newAdaptiveLimit(32, time.Now)
+
+	phases := []struct {
+		link     simulatedLink
+		min, max int
+	}{
+		// Slow start overshoots a link saturated by 8 connections, backs
+		// off and hovers where another connection stops paying off.
+		{simulatedLink{8 << 20, 1 << 20, 50 * time.Millisecond}, 8, 9},
+		// Congestion from other traffic halves the usable capacity.
+		{simulatedLink{4 << 20, 1 << 20, 50 * time.Millisecond}, 4, 5},
+		// Once it clears, connections are added back one at a time.
+		{simulatedLink{16 << 20, 1 << 20, 50 * time.Millisecond}, 16, 17},
+	}
+
+	for i, phase := range phases {
+		for window := 0; window < 40; window++ {
+			a.adjust(phase.link.window(a.limit))
+
+			if a.limit < 1 || a.limit > a.max {
+				t.Fatalf("Failed phase %d window %d: limit %d out of bounds \n", i, window, a.limit)
+			}
+
+			// The limit has to settle within the phase.
+			if window >= 30 && (a.limit < phase.min || a.limit > phase.max) {
+				t.Errorf("Failed phase %d window %d: limit %d, expected %d-%d \n", i, window, a.limit, phase.min, phase.max)
+			}
+		}
+	}
+}
+
+func TestAdaptiveLimitAcquire(t *testing.T) {
+	clock := time.Unix(0, 0)
+	a := newAdaptiveLimit(2, func() time.Time { return clock })
+
+	if err := a.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := a.acquire(ctx); err == nil {
+		t.Fatalf("Failed a second request allowed with a limit of %d \n", a.limit)
+	}
+
+	// A window in which requests are answered quickly adds a connection.
+	acquired := make(chan error, 1)
+
+	go func() { acquired <- a.acquire(context.Background()) }()
+
+	a.observeRTT(time.Millisecond)
+	clock = clock.Add(adaptiveWindow)
+	_, _ = a.Write(make([]byte, 1024))
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Failed limit not raised to %d \n", a.max)
+	}
+
+	a.release()
+	a.release()
+
+	if a.active != 0 {
+		t.Errorf("Failed %d requests still active \n", a.active)
+	}
+}
+
+func TestDownloadAdaptive(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 8,
+		Adaptive:         true,
+		OutputDir:        t.TempDir(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Chunks != 32 {
+		t.Errorf("Failed %d chunks, expected 32 \n", result.Chunks)
+	}
+
+	if data, err := os.ReadFile(result.FileName); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, %v \n", len(data), err)
+	}
+}
@@ -0,0 +1,155 @@
+package fastdownloader
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// Assembler puts the byte ranges of a download together, e.g. into a file, a
+// database or an object store. WriteChunk is called concurrently for
+// different ranges. The data of a read from r counts as stored once WriteChunk
+// reads again or returns, even with the error of r, so it must not be kept
+// in a buffer past that. A range that fails midway is continued by another
+// call for the offset its stored data reached. Finalize is called once all
+// ranges were written, and not after a failure.
+type Assembler interface {
+	WriteChunk(offset uint64, r io.Reader) error
+	Finalize() error
+}
+
+// WriterAtAssembler writes every range at its offset into Dst, such as a file
+// sized to the download. It is how Download assembles local files and Sinks.
+type WriterAtAssembler struct {
+	Dst io.WriterAt
+
+	// Sparse skips buffers of zeros instead of writing them. Dst has to start
+	// out zeroed, like a freshly truncated file, whose skipped regions stay
+	// holes that take no disk space on filesystems with sparse files.
+	Sparse bool
+
+	// BufferSize is the size of the reads from r. DefaultBufferSize is used
+	// when zero.
+	BufferSize uint64
+}
+
+func (a *WriterAtAssembler) WriteChunk(offset uint64, r io.Reader) error {
+	size := a.BufferSize
+	if size == 0 {
+		size = DefaultBufferSize
+	}
+
+	buffer := make([]byte, size)
+
+	for {
+		n, err := r.Read(buffer)
+
+		if n > 0 && !(a.Sparse && isZero(buffer[:n])) {
+			if _, err := a.Dst.WriteAt(buffer[:n], int64(offset)); err != nil {
+				return err
+			}
+		}
+
+		offset += uint64(n)
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Finalize does nothing; Dst is closed by its owner.
+func (a *WriterAtAssembler) Finalize() error {
+	return nil
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// chunkReader feeds the body of a range request for chunk to an Assembler.
+// The data of a read is stored once the Assembler reads again or returns, so
+// only then it is counted as written and passed on to progress. The read
+// error is kept to tell it from a failure of the Assembler.
+type chunkReader struct {
+	reader   io.Reader
+	chunk    *chunk
+	progress io.Writer
+
+	pending []byte
+	err     error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if err := r.commit(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+	r.pending = p[:n]
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// commit counts the data of the last read as written.
+func (r *chunkReader) commit() error {
+	data := r.pending
+	r.pending = nil
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	atomic.AddUint64(&r.chunk.Written, uint64(len(data)))
+
+	if _, err := r.progress.Write(data); err != nil {
+		r.err = err
+
+		return err
+	}
+
+	return nil
+}
+
+// writeChunk hands the rest of the body of c to asm. Data the Assembler
+// read before failing on its own isn't counted, so the next attempt fetches
+// it again.
+func writeChunk(asm Assembler, c *chunk, body io.Reader, progress io.Writer) error {
+	reader := &chunkReader{reader: body, chunk: c, progress: progress}
+
+	err := asm.WriteChunk(c.Start+atomic.LoadUint64(&c.Written), reader)
+	if err == nil || (reader.err != nil && errors.Is(err, reader.err)) {
+		if commitErr := reader.commit(); err == nil {
+			err = commitErr
+		}
+	}
+
+	return err
+}
+
+// assemblerSource returns what the ranges written by asm can be read back
+// from, if anything.
+func assemblerSource(asm Assembler) (io.ReaderAt, bool) {
+	var dst any = asm
+	if w, ok := asm.(*WriterAtAssembler); ok {
+		dst = w.Dst
+	}
+
+	src, ok := dst.(io.ReaderAt)
+
+	return src, ok
+}
@@ -0,0 +1,228 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingAssembler keeps the data of every WriteChunk call by offset.
+type recordingAssembler struct {
+	mu        sync.Mutex
+	writes    map[uint64][]byte
+	finalized int
+}
+
+func (a *recordingAssembler) WriteChunk(offset uint64, r io.Reader) error {
+	data, err := io.ReadAll(r)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.writes == nil {
+		a.writes = map[uint64][]byte{}
+	}
+
+	a.writes[offset] = data
+
+	return err
+}
+
+func (a *recordingAssembler) Finalize() error {
+	a.finalized++
+
+	return nil
+}
+
+func TestDownloadToAssembler(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	for _, acceptRanges := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		asm := &recordingAssembler{}
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:         4,
+			Assembler:      asm,
+			OutputDir:      t.TempDir(),
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed ranges %t: %v \n", acceptRanges, err)
+		}
+
+		var offsets []uint64
+		for offset := range asm.writes {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		expected := []uint64{0}
+		if acceptRanges {
+			expected = []uint64{0, 16384, 32768, 49152}
+		}
+
+		if len(offsets) != len(expected) {
+			t.Fatalf("Failed ranges %t: offsets %v, expected %v \n", acceptRanges, offsets, expected)
+		}
+
+		var assembled []byte
+
+		for i, offset := range offsets {
+			if offset != expected[i] || offset != uint64(len(assembled)) {
+				t.Errorf("Failed ranges %t: offsets %v, expected %v \n", acceptRanges, offsets, expected)
+			}
+
+			assembled = append(assembled, asm.writes[offset]...)
+		}
+
+		if !bytes.Equal(assembled, content) || result.Bytes != uint64(len(content)) || asm.finalized != 1 {
+			t.Errorf("Failed ranges %t: assembled %d bytes, finalized %d times, result %+v \n",
+				acceptRanges, len(assembled), asm.finalized, result)
+		}
+	}
+}
+
+// failingAssembler reads a little of every range and then fails.
+type failingAssembler struct{}
+
+func (failingAssembler) WriteChunk(offset uint64, r io.Reader) error {
+	_, _ = io.ReadFull(r, make([]byte, 100))
+
+	return errors.New("storage unavailable")
+}
+
+func (failingAssembler) Finalize() error {
+	return errors.New("finalized after a failure")
+}
+
+func TestDownloadToFailingAssembler(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		Chunks:         4,
+		Assembler:      failingAssembler{},
+		ProgressOutput: io.Discard,
+	})
+	if err == nil || err.Error() == "finalized after a failure" {
+		t.Errorf("Failed got %v, expected the assembler's error \n", err)
+	}
+}
+
+func TestDownloadToAssemblerRejectsSink(t *testing.T) {
+	_, err := Download(context.Background(), "http://example.com/file.bin", Options{
+		Sink:           &memorySink{},
+		Assembler:      &recordingAssembler{},
+		ProgressOutput: io.Discard,
+	})
+	if err == nil {
+		t.Errorf("Failed download started with both a Sink and an Assembler \n")
+	}
+}
+
+// recordingWriterAt records the offset of every write.
+type recordingWriterAt struct {
+	memorySink
+	offsets []int64
+}
+
+func (w *recordingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.offsets = append(w.offsets, off)
+
+	return w.memorySink.WriteAt(p, off)
+}
+
+func TestWriterAtAssemblerSparse(t *testing.T) {
+	// Data, zeros, data, in buffers of four bytes.
+	content := []byte("abcd\x00\x00\x00\x00\x00\x00\x00\x00efgh")
+
+	testCases := []struct {
+		sparse  bool
+		offsets []int64
+	}{
+		{sparse: false, offsets: []int64{10, 14, 18, 22}},
+		{sparse: true, offsets: []int64{10, 22}},
+	}
+
+	for _, testCase := range testCases {
+		dst := &recordingWriterAt{}
+		asm := &WriterAtAssembler{Dst: dst, Sparse: testCase.sparse, BufferSize: 4}
+
+		if err := asm.WriteChunk(10, bytes.NewReader(content)); err != nil {
+			t.Fatalf("Failed sparse %t: %v \n", testCase.sparse, err)
+		}
+
+		if len(dst.offsets) != len(testCase.offsets) {
+			t.Fatalf("Failed sparse %t: writes at %v, expected %v \n", testCase.sparse, dst.offsets, testCase.offsets)
+		}
+
+		for i, offset := range testCase.offsets {
+			if dst.offsets[i] != offset {
+				t.Errorf("Failed sparse %t: writes at %v, expected %v \n", testCase.sparse, dst.offsets, testCase.offsets)
+			}
+		}
+
+		if !bytes.Equal(dst.data[10:], content) {
+			t.Errorf("Failed sparse %t: wrote %q \n", testCase.sparse, dst.data[10:])
+		}
+	}
+}
+
+func TestDownloadSparse(t *testing.T) {
+	content := make([]byte, 1<<20)
+	copy(content, "header")
+	copy(content[len(content)-7:], "trailer")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	_, err := Download(context.Background(), server.URL+"/disk.img", Options{
+		Chunks:         4,
+		Sparse:         true,
+		OutputDir:      dir,
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "disk.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(saved, content) {
+		t.Errorf("Failed sparse file differs from the download \n")
+	}
+}
@@ -0,0 +1,104 @@
+package fastdownloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const authorizationHeader = "Authorization"
+
+// urlHost returns the host and port of rawURL, or "" when it doesn't parse.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// setAuthorization adds the configured credentials to req. Like curl, the
+// credentials, including an Authorization from Options.Header, only go to the
+// host of the download URL unless Options.AuthOnRedirect is set, so a
+// redirect can't hand them to a third party. Netrc machine entries name their
+// host and go to it wherever it is met, e.g. for a mirror.
+func setAuthorization(req *http.Request, opts Options) {
+	if !opts.AuthOnRedirect && opts.authHost != "" && req.URL.Host != opts.authHost {
+		req.Header.Del(authorizationHeader)
+		setNetrcAuthorization(req, opts, false)
+
+		return
+	}
+
+	switch {
+	case opts.BearerToken != "":
+		req.Header.Set(authorizationHeader, "Bearer "+opts.BearerToken)
+	case opts.Username != "":
+		req.SetBasicAuth(opts.Username, opts.Password)
+	default:
+		setNetrcAuthorization(req, opts, true)
+	}
+}
+
+// setNetrcAuthorization sends the Options.Netrc credentials of the host of req
+// unless it already has credentials, from a header or the URL. The default
+// entry applies only with withDefault.
+func setNetrcAuthorization(req *http.Request, opts Options, withDefault bool) {
+	if req.Header.Get(authorizationHeader) != "" || req.URL.User != nil {
+		return
+	}
+
+	if login, ok := opts.Netrc.lookup(req.URL.Hostname(), withDefault); ok {
+		req.SetBasicAuth(login.login, login.password)
+	}
+}
+
+// redirectPolicy wraps a client's CheckRedirect so redirects carry the
+// Authorization header by the rules of setAuthorization. net/http on its own
+// keeps it for a different port or a subdomain and drops it otherwise. The
+// policy also enforces Options.MaxRedirects and logs every redirect followed.
+func redirectPolicy(
+	checkRedirect func(*http.Request, []*http.Request) error,
+	opts Options,
+) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if auth := via[0].Header.Get(authorizationHeader); auth != "" {
+			if opts.AuthOnRedirect || req.URL.Host == via[0].URL.Host {
+				req.Header.Set(authorizationHeader, auth)
+			} else {
+				req.Header.Del(authorizationHeader)
+			}
+		}
+
+		// A netrc entry of the new host may apply; the default one stays
+		// with the download host.
+		setNetrcAuthorization(req, opts, opts.AuthOnRedirect || req.URL.Host == opts.authHost)
+
+		// A client's own policy replaces the default limit.
+		if limit := opts.MaxRedirects; limit != 0 || checkRedirect == nil {
+			if limit == 0 {
+				limit = DefaultMaxRedirects
+			}
+
+			if len(via) > max(limit, 0) {
+				return fmt.Errorf("%w: the limit is %d", ErrTooManyRedirects, max(limit, 0))
+			}
+		}
+
+		if checkRedirect != nil {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+		}
+
+		status := 0
+		if req.Response != nil {
+			status = req.Response.StatusCode
+		}
+
+		opts.logger().Info("redirect", "from", via[len(via)-1].URL.String(), "to", req.URL.String(), "status", status)
+
+		return nil
+	}
+}
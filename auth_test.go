@@ -0,0 +1,160 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationAcrossRedirects(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	cases := []struct {
+		name             string
+		opts             Options
+		expectedOrigin   string
+		expectedRedirect string
+	}{
+		{"bearer", Options{BearerToken: "TOKEN"}, "Bearer TOKEN", ""},
+		{"auth on redirect", Options{BearerToken: "TOKEN", AuthOnRedirect: true}, "Bearer TOKEN", "Bearer TOKEN"},
+		{"basic", Options{Username: "user", Password: "pass"}, "Basic dXNlcjpwYXNz", ""},
+		{"header", Options{Header: http.Header{"Authorization": {"Custom secret"}}}, "Custom secret", ""},
+		{"none", Options{}, "", ""},
+	}
+
+	for _, testCase := range cases {
+		var (
+			mutex          sync.Mutex
+			originAuth     []string
+			redirectedAuth []string
+		)
+
+		// Both servers listen on 127.0.0.1, so only the port tells them
+		// apart, which already counts as another host.
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			redirectedAuth = append(redirectedAuth, r.Header.Get("Authorization"))
+			mutex.Unlock()
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			originAuth = append(originAuth, r.Header.Get("Authorization"))
+			mutex.Unlock()
+
+			http.Redirect(w, r, target.URL+"/file.bin", http.StatusFound)
+		}))
+
+		opts := testCase.opts
+		opts.OutputDir = t.TempDir()
+		opts.ProgressOutput = io.Discard
+
+		_, err := Download(context.Background(), origin.URL+"/file.bin", opts)
+
+		origin.Close()
+		target.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, auth := range originAuth {
+			if auth != testCase.expectedOrigin {
+				t.Errorf("Failed %s: origin got %q, expected %q \n", testCase.name, auth, testCase.expectedOrigin)
+			}
+		}
+
+		if len(redirectedAuth) == 0 {
+			t.Errorf("Failed %s: redirect target never reached \n", testCase.name)
+		}
+
+		for _, auth := range redirectedAuth {
+			if auth != testCase.expectedRedirect {
+				t.Errorf("Failed %s: redirect target got %q, expected %q \n", testCase.name, auth, testCase.expectedRedirect)
+			}
+		}
+	}
+}
+
+func TestMaxRedirects(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	cases := []struct {
+		name         string
+		hops         int
+		maxRedirects int
+		fails        bool
+	}{
+		{"default limit", 3, 0, false},
+		{"at the limit", 3, 3, false},
+		{"past the limit", 4, 3, true},
+		{"none allowed", 1, -1, true},
+		{"no redirect", 0, -1, false},
+		{"loop", -1, 0, true},
+	}
+
+	for _, testCase := range cases {
+		// /hop/N redirects to /hop/N-1 and /hop/0 serves the file, while
+		// /hop/-1 redirects to itself.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var hop int
+			if _, err := fmt.Sscanf(r.URL.Path, "/hop/%d", &hop); err != nil {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			switch {
+			case hop < 0:
+				http.Redirect(w, r, r.URL.Path, http.StatusFound)
+			case hop > 0:
+				http.Redirect(w, r, fmt.Sprintf("/hop/%d", hop-1), http.StatusFound)
+			default:
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			}
+		}))
+
+		var logs bytes.Buffer
+
+		result, err := Download(context.Background(), fmt.Sprintf("%s/hop/%d", server.URL, testCase.hops), Options{
+			MaxRedirects:   testCase.maxRedirects,
+			OutputPath:     filepath.Join(t.TempDir(), "file.bin"),
+			ProgressOutput: io.Discard,
+			Logger:         slog.New(slog.NewTextHandler(&logs, nil)),
+		})
+
+		server.Close()
+
+		if testCase.fails {
+			if !errors.Is(err, ErrTooManyRedirects) {
+				t.Errorf("Failed %s: %v, expected too many redirects \n", testCase.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if result.URL != server.URL+"/hop/0" {
+			t.Errorf("Failed %s: downloaded from %s \n", testCase.name, result.URL)
+		}
+
+		if hops := strings.Count(logs.String(), "msg=redirect"); hops < testCase.hops || (testCase.hops == 0 && hops != 0) {
+			t.Errorf("Failed %s: logged %d redirects for %d hops \n", testCase.name, hops, testCase.hops)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ParseRange parses an inclusive byte range written as "start-stop", e.g.
+// "1000000-2000000".
+func ParseRange(value string) (Range, error) {
+	start, stop, found := strings.Cut(strings.TrimSpace(value), "-")
+	if !found {
+		return Range{}, fmt.Errorf("invalid byte range %q, expected start-stop", value)
+	}
+
+	var (
+		r   Range
+		err error
+	)
+
+	if r.Start, err = strconv.ParseUint(start, 10, 64); err != nil {
+		return Range{}, fmt.Errorf("invalid byte range %q, expected start-stop", value)
+	}
+
+	if r.Stop, err = strconv.ParseUint(stop, 10, 64); err != nil {
+		return Range{}, fmt.Errorf("invalid byte range %q, expected start-stop", value)
+	}
+
+	if r.Start > r.Stop {
+		return Range{}, fmt.Errorf("invalid byte range %q, start is past stop", value)
+	}
+
+	return r, nil
+}
+
+// checkByteRange rejects Options.ByteRange combinations Download can't serve.
+func checkByteRange(downloadURL string, opts Options) error {
+	switch {
+	case opts.ByteRange == nil:
+		return nil
+	case opts.ByteRange.Start > opts.ByteRange.Stop:
+		return fmt.Errorf("byte range %d-%d starts past its stop", opts.ByteRange.Start, opts.ByteRange.Stop)
+	case isFTPURL(downloadURL):
+		return errors.New("a byte range can't be downloaded from ftp URLs")
+	case opts.OutputPath == StdoutOutputPath:
+		return errors.New("a byte range can't be combined with writing to stdout")
+	case opts.sinkAssembler() != nil:
+		return errors.New("a byte range can't be combined with a Sink or Assembler")
+	// Checksum lists and manifests describe the whole file, which a range
+	// never matches.
+	case opts.ChecksumList != nil:
+		return errors.New("a byte range can't be combined with a checksum list")
+	case opts.WriteManifest:
+		return errors.New("a byte range can't be combined with writing a manifest")
+	}
+
+	return nil
+}
+
+// rangeFile places the bytes of a byte range download at the start of the
+// output file instead of at their offset in the remote file.
+type rangeFile struct {
+	file *os.File
+	base int64
+}
+
+func (f *rangeFile) WriteAt(data []byte, off int64) (int, error) {
+	return f.file.WriteAt(data, off-f.base)
+}
+
+func (f *rangeFile) ReadAt(data []byte, off int64) (int, error) {
+	return f.file.ReadAt(data, off-f.base)
+}
+
+// rangeDownload saves opts.ByteRange of downloadURL as a file of its own,
+// split into chunks and fetched from the mirrors like a parallel download.
+func rangeDownload(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	remote, err := probeRemoteFile(ctx, downloadURL, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	mirrors, err := probeMirrors(ctx, remote, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(mirrors) == 0 {
+		return Result{}, fmt.Errorf("downloading a byte range: %w", &NoParallelError{Reason: remote.noParallelReason()})
+	}
+
+	r, contentLength := *opts.ByteRange, mirrors[0].contentLength
+	if r.Stop >= contentLength {
+		return Result{}, fmt.Errorf("byte range %d-%d exceeds the %d byte file", r.Start, r.Stop, contentLength)
+	}
+
+	size := r.Stop - r.Start + 1
+
+	fileName, err := targetFileName(remote.fileName, opts)
+	if err != nil {
+		return Result{FileName: fileName}, err
+	}
+
+	partialFileName := partialFilePath(fileName, opts)
+
+	if err := checkSize(partialFileName, size, size, opts); err != nil {
+		return Result{}, err
+	}
+
+	file, err := os.OpenFile(partialFileName, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := file.Truncate(int64(size)); err != nil {
+		_ = file.Close()
+
+		return Result{}, err
+	}
+
+	// The chunks keep their offsets in the remote file, which the range
+	// requests and the ChunkVerifier refer to.
+	chunks := planChunks(size, opts.chunkStrategy())
+	for _, c := range chunks {
+		c.Start += r.Start
+		c.Stop += r.Start
+	}
+
+	progress := newProgressWriter(opts, size)
+	progress.watchChunks(chunks)
+
+	asm := opts.fileAssembler(&rangeFile{file: file, base: int64(r.Start)}, opts.Sparse && opts.ChunkVerifier == nil)
+
+	downloadErr := downloadChunks(ctx, opts, asm, progress, chunks, mirrors)
+	if downloadErr == nil {
+		downloadErr = asm.Finalize()
+	}
+
+	progress.finish()
+
+	closeErr := file.Close()
+
+	// Without a meta sidecar there is nothing to resume from, so the partial
+	// file of a failed range is always removed.
+	if downloadErr != nil || closeErr != nil {
+		_ = os.Remove(partialFileName)
+
+		return Result{}, errors.Join(downloadErr, closeErr)
+	}
+
+	if err := verifyLength(partialFileName, size, opts); err != nil {
+		return Result{}, err
+	}
+
+	manifest := &Manifest{
+		URL:          downloadURL,
+		Mirrors:      opts.Mirrors,
+		ETag:         remote.etag,
+		LastModified: remote.lastModified,
+		Chunks:       len(chunks),
+	}
+
+	checksum, err := finishDownload(partialFileName, fileName, manifest, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return completedResult(fileName, remote.resolvedURL, atomic.LoadUint64(&progress.readBytes), true, manifest, checksum), nil
+}
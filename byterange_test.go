@@ -0,0 +1,121 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		value string
+		r     Range
+		valid bool
+	}{
+		{"1000000-2000000", Range{1000000, 2000000}, true},
+		{" 0-0 ", Range{0, 0}, true},
+		{"5-4", Range{}, false},
+		{"5", Range{}, false},
+		{"-5", Range{}, false},
+		{"5-", Range{}, false},
+		{"a-b", Range{}, false},
+	}
+
+	for _, testCase := range cases {
+		r, err := ParseRange(testCase.value)
+		if (err == nil) != testCase.valid || r != testCase.r {
+			t.Errorf("Failed %q: %+v, %v \n", testCase.value, r, err)
+		}
+	}
+}
+
+func TestDownloadByteRange(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var progress, total uint64
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ByteRange:        &Range{Start: 1000, Stop: 40999},
+		ParallelRequests: 3,
+		Chunks:           4,
+		OutputDir:        t.TempDir(),
+		ProgressOutput:   io.Discard,
+		ProgressFunc:     func(downloaded, size uint64) { progress, total = downloaded, size },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content[1000:41000]) {
+		t.Errorf("Failed range content mismatch \n")
+	}
+
+	if result.Bytes != 40000 || progress != 40000 || total != 40000 {
+		t.Errorf("Failed %d bytes, progress %d/%d, expected 40000 \n", result.Bytes, progress, total)
+	}
+
+	if _, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ByteRange:      &Range{Start: 1000, Stop: uint64(len(content))},
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	}); err == nil {
+		t.Errorf("Failed range past the end accepted \n")
+	}
+}
+
+func TestDownloadByteRangeWithoutRangeSupport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ByteRange:      &Range{Start: 2, Stop: 5},
+		OutputDir:      dir,
+		ProgressOutput: io.Discard,
+	})
+	if !errors.Is(err, ErrNoParallelDownload) {
+		t.Errorf("Failed %v, expected ErrNoParallelDownload \n", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Failed %d files left behind \n", len(entries))
+	}
+}
+
+func TestCheckByteRange(t *testing.T) {
+	r := &Range{Start: 2, Stop: 5}
+
+	cases := []struct {
+		name  string
+		url   string
+		opts  Options
+		fails bool
+	}{
+		{"whole file", "http://example.com/file", Options{ChecksumList: ChecksumList{}, WriteManifest: true}, false},
+		{"range", "http://example.com/file", Options{ByteRange: r, Checksum: "md5:5d41402abc4b2a76b9719d911017c592"}, false},
+		{"ftp", "ftp://example.com/file", Options{ByteRange: r}, true},
+		{"stdout", "http://example.com/file", Options{ByteRange: r, OutputPath: StdoutOutputPath}, true},
+		{"checksum list", "http://example.com/file", Options{ByteRange: r, ChecksumList: ChecksumList{}}, true},
+		{"manifest", "http://example.com/file", Options{ByteRange: r, WriteManifest: true}, true},
+	}
+
+	for _, testCase := range cases {
+		if err := checkByteRange(testCase.url, testCase.opts); (err != nil) != testCase.fails {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"crypto/md5"  //nolint:gosec
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when the downloaded file doesn't match the
+// expected checksum. The file is removed in that case.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+type checksum struct {
+	algorithm string
+	newHash   func() hash.Hash
+	expected  []byte
+}
+
+// parseChecksum parses an "algorithm:hex" value such as "sha256:abcdef...".
+func parseChecksum(value string) (*checksum, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid checksum %q, expected algorithm:hex", value)
+	}
+
+	algorithm := strings.ToLower(parts[0])
+
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", parts[0])
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q: %w", value, err)
+	}
+
+	if len(expected) != newHash().Size() {
+		return nil, fmt.Errorf("invalid %s checksum length %d", algorithm, len(expected))
+	}
+
+	return &checksum{algorithm: algorithm, newHash: newHash, expected: expected}, nil
+}
+
+// String formats the checksum as "algorithm:hex".
+func (c *checksum) String() string {
+	return c.algorithm + ":" + hex.EncodeToString(c.expected)
+}
+
+// verify compares the sum of h with the expected checksum.
+func (c *checksum) verify(h hash.Hash) error {
+	return c.verifySum(h.Sum(nil))
+}
+
+// verifySum compares actual with the expected checksum.
+func (c *checksum) verifySum(actual []byte) error {
+	if !bytes.Equal(actual, c.expected) {
+		return fmt.Errorf(
+			"%w: %s expected %x, got %x",
+			ErrChecksumMismatch,
+			c.algorithm,
+			c.expected,
+			actual,
+		)
+	}
+
+	return nil
+}
+
+// hashFile writes the content of fileName to h.
+func hashFile(fileName string, h io.Writer) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(h, file)
+
+	_ = file.Close()
+
+	return err
+}
+
+// hashFileSums reads fileName once and returns its sum for every algorithm
+// of checksumAlgorithms in algorithms, by algorithm. The file isn't read
+// without algorithms.
+func hashFileSums(fileName string, algorithms []string) (map[string][]byte, error) {
+	hashes := map[string]hash.Hash{}
+
+	var writers []io.Writer
+
+	for _, algorithm := range algorithms {
+		if _, ok := hashes[algorithm]; ok {
+			continue
+		}
+
+		h := checksumAlgorithms[algorithm]()
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+
+	sums := map[string][]byte{}
+
+	if len(writers) == 0 {
+		return sums, nil
+	}
+
+	if err := hashFile(fileName, io.MultiWriter(writers...)); err != nil {
+		return nil, err
+	}
+
+	for algorithm, h := range hashes {
+		sums[algorithm] = h.Sum(nil)
+	}
+
+	return sums, nil
+}
+
+// sumChecksum formats the sum in sums that describes the file best as
+// "algorithm:hex": the one of the checksum, the SHA-256 or the one of the
+// server's digest, in that order. It is empty when the file wasn't hashed.
+func sumChecksum(sums map[string][]byte, opts Options) string {
+	var algorithms []string
+
+	if opts.checksum != nil {
+		algorithms = append(algorithms, opts.checksum.algorithm)
+	}
+
+	algorithms = append(algorithms, "sha256")
+
+	if opts.digest != nil {
+		algorithms = append(algorithms, opts.digest.algorithm)
+	}
+
+	for _, algorithm := range algorithms {
+		if sum, ok := sums[algorithm]; ok {
+			return algorithm + ":" + hex.EncodeToString(sum)
+		}
+	}
+
+	return ""
+}
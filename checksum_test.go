@@ -0,0 +1,93 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"  //nolint:gosec
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChecksum(t *testing.T) {
+	cases := []struct {
+		value string
+		fails bool
+	}{
+		{"sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", false},
+		{"SHA1:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", false},
+		{"md5:5d41402abc4b2a76b9719d911017c592", false},
+		{"sha512:5d41402abc4b2a76b9719d911017c592", true},
+		{"md5:5d41402abc4b2a76", true},
+		{"md5:not-hex", true},
+		{"5d41402abc4b2a76b9719d911017c592", true},
+	}
+
+	for _, testCase := range cases {
+		_, err := parseChecksum(testCase.value)
+		if (err != nil) != testCase.fails {
+			t.Errorf("Failed %s: %v \n", testCase.value, err)
+		}
+	}
+}
+
+func TestHashFileSums(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(fileName, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	md5Sum := md5.Sum(content)   //nolint:gosec
+	sha1Sum := sha1.Sum(content) //nolint:gosec
+	sha256Sum := sha256.Sum256(content)
+
+	expected := map[string][]byte{"md5": md5Sum[:], "sha1": sha1Sum[:], "sha256": sha256Sum[:]}
+
+	sums, err := hashFileSums(fileName, []string{"sha256", "md5", "sha1", "sha256"})
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	if !reflect.DeepEqual(sums, expected) {
+		t.Errorf("Failed sums %x, expected %x \n", sums, expected)
+	}
+
+	// Without algorithms the file isn't read at all.
+	if sums, err := hashFileSums(filepath.Join(t.TempDir(), "missing"), nil); err != nil || len(sums) != 0 {
+		t.Errorf("Failed sums %x, %v without algorithms \n", sums, err)
+	}
+}
+
+func TestDownloadAnnouncesVerification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "hello.txt", time.Time{}, strings.NewReader("hello"))
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+
+	_, err := Download(context.Background(), server.URL+"/hello.txt", Options{
+		OutputDir:      t.TempDir(),
+		HTTPClient:     server.Client(),
+		Checksum:       "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		ProgressOutput: &output,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phase := strings.Index(output.String(), "\nVerifying sha256 checksum...")
+
+	if phase < 0 || phase < strings.LastIndex(output.String(), "(100%)") {
+		t.Errorf("Failed verification phase not announced after the download: %q \n", output.String())
+	}
+}
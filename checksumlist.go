@@ -0,0 +1,151 @@
+package fastdownloader
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumList holds the "algorithm:hex" checksums of a sums file such as
+// SHA256SUMS by file name.
+type ChecksumList map[string]string
+
+// checksumAlgorithmSizes names the algorithm of a digest by its size in
+// bytes, which differs for every supported algorithm.
+var checksumAlgorithmSizes = map[int]string{
+	16: "md5",
+	20: "sha1",
+	32: "sha256",
+}
+
+// ParseChecksumList reads a sums file in the format of sha256sum and its
+// siblings, "hex  name" or "hex *name" lines, or in the BSD format of
+// "sha256sum --tag", "SHA256 (name) = hex" lines. algorithm applies to the
+// former; when empty it is told by the length of the digests. Blank lines and
+// lines starting with # are skipped. Names are stored without their
+// directories.
+func ParseChecksumList(r io.Reader, algorithm string) (ChecksumList, error) {
+	algorithm = strings.ToLower(algorithm)
+
+	if _, ok := checksumAlgorithms[algorithm]; !ok && algorithm != "" {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	list := ChecksumList{}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lineAlgorithm, digest, name, ok := parseBSDChecksumLine(line)
+		if !ok {
+			lineAlgorithm, digest, name, ok = parseChecksumLine(line, algorithm)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("checksum list line %d: invalid line %q", lineNumber, line)
+		}
+
+		sum, err := hex.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("checksum list line %d: invalid digest %q", lineNumber, digest)
+		}
+
+		if lineAlgorithm == "" {
+			lineAlgorithm = checksumAlgorithmSizes[len(sum)]
+		}
+
+		checksum, err := parseChecksum(lineAlgorithm + ":" + digest)
+		if err != nil {
+			return nil, fmt.Errorf("checksum list line %d: %w", lineNumber, err)
+		}
+
+		list[path.Base(name)] = checksum.String()
+	}
+
+	return list, scanner.Err()
+}
+
+// parseChecksumLine splits a "hex  name" line. A name starting with * was
+// hashed in binary mode, which makes no difference here. A line starting with
+// a backslash has a name with escaped backslashes and newlines.
+func parseChecksumLine(line, algorithm string) (lineAlgorithm, digest, name string, ok bool) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	digest, name, found := strings.Cut(line, " ")
+	if !found || digest == "" {
+		return "", "", "", false
+	}
+
+	// sha256sum separates them by a space and a mode character, but a
+	// single space is common in hand written lists.
+	name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+
+	if escaped {
+		name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+	}
+
+	return algorithm, digest, name, name != ""
+}
+
+// parseBSDChecksumLine splits a "SHA256 (name) = hex" line.
+func parseBSDChecksumLine(line string) (algorithm, digest, name string, ok bool) {
+	tag, rest, found := strings.Cut(line, " (")
+	if !found {
+		return "", "", "", false
+	}
+
+	separator := strings.LastIndex(rest, ") = ")
+	if separator < 0 {
+		return "", "", "", false
+	}
+
+	// OpenBSD's sha256 writes "SHA2-256" where sha256sum --tag writes
+	// "SHA256".
+	algorithm = strings.ToLower(strings.Replace(tag, "SHA2-", "SHA", 1))
+
+	if _, supported := checksumAlgorithms[algorithm]; !supported {
+		return "", "", "", false
+	}
+
+	return algorithm, rest[separator+len(") = "):], rest[:separator], true
+}
+
+// lookup returns the checksum listed for the file fileName is saved as.
+func (l ChecksumList) lookup(fileName string) (*checksum, error) {
+	value, ok := l[filepath.Base(fileName)]
+	if !ok {
+		return nil, fmt.Errorf("%s isn't listed in the checksum list", filepath.Base(fileName))
+	}
+
+	return parseChecksum(value)
+}
+
+// listedChecksum sets the checksum of fileName from Options.ChecksumList
+// unless Options.Checksum is set.
+func listedChecksum(fileName string, opts Options) (Options, error) {
+	if opts.checksum != nil || opts.ChecksumList == nil {
+		return opts, nil
+	}
+
+	checksum, err := opts.ChecksumList.lookup(fileName)
+	if err != nil {
+		return opts, err
+	}
+
+	opts.checksum = checksum
+
+	return opts, nil
+}
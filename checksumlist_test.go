@@ -0,0 +1,122 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChecksumList(t *testing.T) {
+	sha := sha256.Sum256([]byte("content"))
+	sum := md5.Sum([]byte("content")) //nolint:gosec
+	shaHex, md5Hex := hex.EncodeToString(sha[:]), hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name      string
+		list      string
+		algorithm string
+		expected  ChecksumList
+		invalid   bool
+	}{
+		{
+			"standard",
+			"# release 1.0\n" + shaHex + "  image.iso\n" + shaHex + " *bin/tool.exe\r\n\n",
+			"sha256",
+			ChecksumList{"image.iso": "sha256:" + shaHex, "tool.exe": "sha256:" + shaHex},
+			false,
+		},
+		// The algorithm is told by the length of the digests.
+		{"md5", md5Hex + "  image.iso\n", "", ChecksumList{"image.iso": "md5:" + md5Hex}, false},
+		{"escaped", `\` + shaHex + `  back\\slash.iso` + "\n", "", ChecksumList{`back\slash.iso`: "sha256:" + shaHex}, false},
+		{
+			"bsd",
+			"SHA256 (image (1).iso) = " + shaHex + "\nMD5 (image.iso) = " + md5Hex + "\nSHA2-256 (other.iso) = " + shaHex + "\n",
+			"",
+			ChecksumList{"image (1).iso": "sha256:" + shaHex, "image.iso": "md5:" + md5Hex, "other.iso": "sha256:" + shaHex},
+			false,
+		},
+		{"wrong algorithm", md5Hex + "  image.iso\n", "sha256", nil, true},
+		{"unsupported algorithm", shaHex + "  image.iso\n", "crc32", nil, true},
+		{"bad digest", "xyz  image.iso\n", "", nil, true},
+		{"no name", shaHex + "\n", "", nil, true},
+	}
+
+	for _, testCase := range cases {
+		list, err := ParseChecksumList(strings.NewReader(testCase.list), testCase.algorithm)
+		if (err != nil) != testCase.invalid {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+
+			continue
+		}
+
+		if len(list) != len(testCase.expected) {
+			t.Errorf("Failed %s: %v, expected %v \n", testCase.name, list, testCase.expected)
+		}
+
+		for name, expected := range testCase.expected {
+			if list[name] != expected {
+				t.Errorf("Failed %s: %s is %q, expected %q \n", testCase.name, name, list[name], expected)
+			}
+		}
+	}
+}
+
+func TestDownloadChecksumList(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sha := sha256.Sum256(content)
+	wrong := sha256.Sum256([]byte("something else"))
+
+	cases := []struct {
+		name         string
+		list         ChecksumList
+		acceptRanges bool
+		mismatch     bool
+		invalid      bool
+	}{
+		{"serial", ChecksumList{"file.bin": "sha256:" + hex.EncodeToString(sha[:])}, false, false, false},
+		{"parallel", ChecksumList{"file.bin": "sha256:" + hex.EncodeToString(sha[:])}, true, false, false},
+		{"mismatch", ChecksumList{"file.bin": "sha256:" + hex.EncodeToString(wrong[:])}, true, true, true},
+		{"not listed", ChecksumList{"other.bin": "sha256:" + hex.EncodeToString(sha[:])}, true, false, true},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !testCase.acceptRanges {
+				_, _ = w.Write(content)
+
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 4,
+			ChecksumList:     testCase.list,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if (err != nil) != testCase.invalid || errors.Is(err, ErrChecksumMismatch) != testCase.mismatch {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if fileExists(filepath.Join(dir, "file.bin")) == testCase.invalid {
+			t.Errorf("Failed %s: the file was kept: %t \n", testCase.name, !testCase.invalid)
+		}
+	}
+}
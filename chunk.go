@@ -0,0 +1,126 @@
+package fastdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// partialFileSuffix marks a download that hasn't completed yet.
+	partialFileSuffix = ".download"
+
+	// metaFileSuffix is appended to the partial file name for the sidecar that
+	// records how far each chunk got, so an interrupted download can resume.
+	metaFileSuffix = ".meta"
+)
+
+// chunk is a byte range [Start, Stop] of a parallel download and the number of
+// its bytes already written to the destination file.
+type chunk struct {
+	Start   uint64 `json:"start"`
+	Stop    uint64 `json:"stop"`
+	Written uint64 `json:"written"`
+}
+
+func (c *chunk) size() uint64 {
+	return c.Stop - c.Start + 1
+}
+
+func (c *chunk) remaining() uint64 {
+	return c.size() - c.Written
+}
+
+// partialFilePath is where the partial file of fileName is written: next to
+// it, or in Options.TempDir when set.
+func partialFilePath(fileName string, opts Options) string {
+	if opts.TempDir == "" {
+		return fileName + partialFileSuffix
+	}
+
+	return filepath.Join(opts.TempDir, filepath.Base(fileName)+partialFileSuffix)
+}
+
+// keepPartial reports whether the partial file of a download that failed with
+// err stays for a later resume. It does when the download was interrupted or
+// failed on a transient error, and with KeepPartial; a permanent failure
+// removes it, like RemovePartial always does.
+func keepPartial(err error, opts Options) bool {
+	if opts.RemovePartial {
+		return false
+	}
+
+	return opts.KeepPartial || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || isRetryable(err)
+}
+
+// partialMeta is the content of the meta sidecar.
+type partialMeta struct {
+	ContentLength uint64 `json:"contentLength"`
+
+	// Validator is the remote file's ETag or Last-Modified at the time the
+	// download started. A resume only continues when it still matches.
+	Validator string   `json:"validator,omitempty"`
+	Chunks    []*chunk `json:"chunks"`
+}
+
+func planChunks(contentLength uint64, strategy ChunkStrategy) []*chunk {
+	var chunks []*chunk
+
+	for _, r := range strategy.Split(contentLength) {
+		chunks = append(chunks, &chunk{Start: r.Start, Stop: r.Stop})
+	}
+
+	return chunks
+}
+
+// loadPartialMeta returns the chunks of an interrupted download of
+// partialFileName, or nil when there is nothing usable to resume from or the
+// remote file changed since.
+func loadPartialMeta(partialFileName string, contentLength uint64, validator string) []*chunk {
+	data, err := os.ReadFile(partialFileName + metaFileSuffix)
+	if err != nil {
+		return nil
+	}
+
+	var meta partialMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.ContentLength != contentLength || meta.Validator != validator {
+		return nil
+	}
+
+	info, err := os.Stat(partialFileName)
+	if err != nil || uint64(info.Size()) != contentLength {
+		return nil
+	}
+
+	// The chunks must tile [0, contentLength) exactly; a gap or an overlap
+	// would let a resumed download complete with a hole in it.
+	sort.Slice(meta.Chunks, func(i, j int) bool { return meta.Chunks[i].Start < meta.Chunks[j].Start })
+
+	next := uint64(0)
+
+	for _, c := range meta.Chunks {
+		if c.Start != next || c.Stop < c.Start || c.Stop >= contentLength || c.Written > c.size() {
+			return nil
+		}
+
+		next = c.Stop + 1
+	}
+
+	if next != contentLength {
+		return nil
+	}
+
+	return meta.Chunks
+}
+
+func savePartialMeta(partialFileName string, contentLength uint64, validator string, chunks []*chunk) error {
+	data, err := json.Marshal(partialMeta{ContentLength: contentLength, Validator: validator, Chunks: chunks})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(partialFileName+metaFileSuffix, data, 0666)
+}
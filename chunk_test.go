@@ -0,0 +1,82 @@
+package fastdownloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPartialMeta(t *testing.T) {
+	partialFileName := filepath.Join(t.TempDir(), "file.bin"+partialFileSuffix)
+
+	if err := os.WriteFile(partialFileName, make([]byte, 100), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []*chunk{{Start: 0, Stop: 49, Written: 10}, {Start: 50, Stop: 99, Written: 50}}
+
+	if err := savePartialMeta(partialFileName, 100, `"v1"`, chunks); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		contentLength uint64
+		validator     string
+		resumable     bool
+	}{
+		{100, `"v1"`, true},
+		{100, `"v2"`, false},
+		{100, "", false},
+		{101, `"v1"`, false},
+	}
+
+	for _, testCase := range cases {
+		loaded := loadPartialMeta(partialFileName, testCase.contentLength, testCase.validator)
+
+		if (loaded != nil) != testCase.resumable {
+			t.Errorf("Failed %d %s: resumable %t, expected %t \n",
+				testCase.contentLength, testCase.validator, loaded != nil, testCase.resumable)
+		}
+
+		if loaded != nil && (len(loaded) != 2 || loaded[0].Written != 10 || loaded[1].Written != 50) {
+			t.Errorf("Failed %+v \n", loaded)
+		}
+	}
+}
+
+func TestLoadPartialMetaRejectsGaps(t *testing.T) {
+	partialFileName := filepath.Join(t.TempDir(), "file.bin"+partialFileSuffix)
+
+	if err := os.WriteFile(partialFileName, make([]byte, 100), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		chunks    []*chunk
+		resumable bool
+	}{
+		{"unordered", []*chunk{{Start: 50, Stop: 99}, {Start: 0, Stop: 49}}, true},
+		{"gap", []*chunk{{Start: 0, Stop: 39}, {Start: 50, Stop: 99}}, false},
+		{"overlap", []*chunk{{Start: 0, Stop: 59}, {Start: 50, Stop: 99}}, false},
+		{"short", []*chunk{{Start: 0, Stop: 49}, {Start: 50, Stop: 89}}, false},
+		{"late start", []*chunk{{Start: 10, Stop: 99}}, false},
+		{"empty", nil, false},
+	}
+
+	for _, testCase := range cases {
+		if err := savePartialMeta(partialFileName, 100, `"v1"`, testCase.chunks); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := loadPartialMeta(partialFileName, 100, `"v1"`)
+
+		if (loaded != nil) != testCase.resumable {
+			t.Errorf("Failed %s: resumable %t, expected %t \n", testCase.name, loaded != nil, testCase.resumable)
+		}
+
+		if loaded != nil && loaded[0].Start != 0 {
+			t.Errorf("Failed %s: chunks not sorted %+v \n", testCase.name, loaded)
+		}
+	}
+}
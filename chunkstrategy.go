@@ -0,0 +1,113 @@
+package fastdownloader
+
+import "fmt"
+
+// DefaultChunkSize is the chunk size of FixedSizeChunks and the first chunk
+// of GeometricChunks when their size is zero.
+const DefaultChunkSize uint64 = 1024 * 1024
+
+// ChunkStrategy splits a file of contentLength bytes into the byte ranges of
+// a parallel download. The ranges must cover the file in order without gaps
+// or overlaps.
+type ChunkStrategy interface {
+	Split(contentLength uint64) []Range
+}
+
+// EqualChunks splits the file into Count ranges of nearly equal size.
+type EqualChunks struct {
+	Count uint64
+}
+
+func (s EqualChunks) Split(contentLength uint64) []Range {
+	var ranges []Range
+
+	generator := batchGenerator(contentLength, s.Count)
+
+	for {
+		start, stop, ok := generator()
+		if !ok {
+			return ranges
+		}
+
+		ranges = append(ranges, Range{Start: start, Stop: stop})
+	}
+}
+
+// FixedSizeChunks splits the file into ranges of Size bytes; only the last
+// one may be shorter.
+type FixedSizeChunks struct {
+	Size uint64
+}
+
+func (s FixedSizeChunks) Split(contentLength uint64) []Range {
+	size := s.Size
+	if size == 0 {
+		size = DefaultChunkSize
+	}
+
+	return splitBySize(contentLength, func() uint64 { return size })
+}
+
+// GeometricChunks starts with a range of FirstSize bytes and doubles the size
+// of every following one. The beginning of the file arrives quickly, which
+// suits formats that can be previewed while streaming, and the tail needs few
+// requests.
+type GeometricChunks struct {
+	FirstSize uint64
+}
+
+func (s GeometricChunks) Split(contentLength uint64) []Range {
+	size := s.FirstSize
+	if size == 0 {
+		size = DefaultChunkSize
+	}
+
+	return splitBySize(contentLength, func() uint64 {
+		current := size
+		if size <= contentLength {
+			size *= 2
+		}
+
+		return current
+	})
+}
+
+// splitBySize cuts contentLength bytes into consecutive ranges whose sizes
+// are returned by nextSize.
+func splitBySize(contentLength uint64, nextSize func() uint64) []Range {
+	var ranges []Range
+
+	for start := uint64(0); start < contentLength; {
+		size := nextSize()
+		if size > contentLength-start {
+			size = contentLength - start
+		}
+
+		ranges = append(ranges, Range{Start: start, Stop: start + size - 1})
+		start += size
+	}
+
+	return ranges
+}
+
+// ParseChunkStrategy returns the strategy called name: "fixed" splits into
+// ranges of size bytes and "geometric" starts at size bytes and doubles from
+// there. "equal" returns nil, which selects the default EqualChunks of
+// Options.Chunks ranges. An empty name means fixed when a size is given and
+// equal otherwise.
+func ParseChunkStrategy(name string, size uint64) (ChunkStrategy, error) {
+	if name == "" && size > 0 {
+		name = "fixed"
+	}
+
+	switch name {
+	case "", "equal":
+		return nil, nil
+	case "fixed":
+		return FixedSizeChunks{Size: size}, nil
+	case "geometric":
+		return GeometricChunks{FirstSize: size}, nil
+	}
+
+	return nil, fmt.Errorf("unknown chunk strategy %q, expected equal, fixed or geometric", name)
+}
@@ -0,0 +1,87 @@
+package fastdownloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkStrategies(t *testing.T) {
+	cases := []struct {
+		strategy      ChunkStrategy
+		contentLength uint64
+		expected      []Range
+	}{
+		{EqualChunks{Count: 3}, 10, []Range{{0, 3}, {4, 6}, {7, 9}}},
+		{FixedSizeChunks{Size: 4}, 10, []Range{{0, 3}, {4, 7}, {8, 9}}},
+		{FixedSizeChunks{Size: 5}, 10, []Range{{0, 4}, {5, 9}}},
+		{GeometricChunks{FirstSize: 1}, 10, []Range{{0, 0}, {1, 2}, {3, 6}, {7, 9}}},
+		{GeometricChunks{FirstSize: 2}, 14, []Range{{0, 1}, {2, 5}, {6, 13}}},
+		{GeometricChunks{FirstSize: 100}, 10, []Range{{0, 9}}},
+		{FixedSizeChunks{Size: 4}, 0, nil},
+	}
+
+	for _, testCase := range cases {
+		ranges := testCase.strategy.Split(testCase.contentLength)
+
+		if !reflect.DeepEqual(ranges, testCase.expected) {
+			t.Errorf("Failed %T %+v: %v != %v \n", testCase.strategy, testCase.strategy, ranges, testCase.expected)
+		}
+	}
+}
+
+func TestChunkStrategiesCoverContent(t *testing.T) {
+	strategies := []ChunkStrategy{
+		EqualChunks{Count: 7},
+		FixedSizeChunks{},
+		FixedSizeChunks{Size: 1000},
+		GeometricChunks{},
+		GeometricChunks{FirstSize: 3},
+	}
+
+	for _, strategy := range strategies {
+		for _, contentLength := range []uint64{1, 999, 1000, 1001, 5*1024*1024 + 17} {
+			next := uint64(0)
+
+			for _, r := range strategy.Split(contentLength) {
+				if r.Start != next || r.Stop < r.Start {
+					t.Errorf("Failed %T %+v %d: range %+v after %d \n", strategy, strategy, contentLength, r, next)
+				}
+
+				next = r.Stop + 1
+			}
+
+			if next != contentLength {
+				t.Errorf("Failed %T %+v %d: covered %d bytes \n", strategy, strategy, contentLength, next)
+			}
+		}
+	}
+}
+
+func TestParseChunkStrategy(t *testing.T) {
+	cases := []struct {
+		name       string
+		size       uint64
+		expected   ChunkStrategy
+		shouldFail bool
+	}{
+		{"", 0, nil, false},
+		{"", 512, FixedSizeChunks{Size: 512}, false},
+		{"equal", 512, nil, false},
+		{"fixed", 512, FixedSizeChunks{Size: 512}, false},
+		{"fixed", 0, FixedSizeChunks{}, false},
+		{"geometric", 512, GeometricChunks{FirstSize: 512}, false},
+		{"random", 512, nil, true},
+	}
+
+	for _, testCase := range cases {
+		strategy, err := ParseChunkStrategy(testCase.name, testCase.size)
+
+		if (err != nil) != testCase.shouldFail {
+			t.Errorf("Failed %s: unexpected error %v \n", testCase.name, err)
+		}
+
+		if strategy != testCase.expected {
+			t.Errorf("Failed %s: %+v != %+v \n", testCase.name, strategy, testCase.expected)
+		}
+	}
+}
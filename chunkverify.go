@@ -0,0 +1,275 @@
+package fastdownloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrChunkMismatch is returned by a ChunkVerifier for a corrupt chunk. The
+// chunk is fetched again, from another mirror when there is one, before the
+// download fails with it.
+var ErrChunkMismatch = errors.New("chunk checksum mismatch")
+
+// ChunkVerifier checks every completed chunk of a parallel download on its
+// own, so a corrupt chunk is fetched again instead of failing the whole file
+// at the end.
+type ChunkVerifier interface {
+	// VerifyChunk reads the bytes of r, a chunk of a file of size bytes, from
+	// data and returns an error wrapping ErrChunkMismatch when they are
+	// corrupt.
+	VerifyChunk(r Range, size uint64, data io.Reader) error
+}
+
+// BlockChecksums verifies chunks against the digests of consecutive blocks of
+// BlockSize bytes, as published in per-block checksum lists; only the last
+// block may be shorter. A chunk only checks the blocks it covers completely,
+// so a FixedSizeChunks strategy with a multiple of BlockSize verifies every
+// byte.
+type BlockChecksums struct {
+	BlockSize uint64
+	NewHash   func() hash.Hash
+	Sums      [][]byte
+}
+
+// ParseBlockChecksums reads one hex digest per block, in order, as
+// "digest" or "digest  name" lines like sha256sum writes them. Blank lines and
+// lines starting with # are skipped. Supported algorithms are sha256, sha1 and
+// md5.
+func ParseBlockChecksums(r io.Reader, algorithm string, blockSize uint64) (*BlockChecksums, error) {
+	newHash, ok := checksumAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	if blockSize == 0 {
+		return nil, errors.New("block size must be positive")
+	}
+
+	sums := &BlockChecksums{BlockSize: blockSize, NewHash: newHash}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != newHash().Size() {
+			return nil, fmt.Errorf("block checksums line %d: invalid %s digest %q", lineNumber, algorithm, fields[0])
+		}
+
+		sums.Sums = append(sums.Sums, sum)
+	}
+
+	return sums, scanner.Err()
+}
+
+func (b *BlockChecksums) VerifyChunk(r Range, size uint64, data io.Reader) error {
+	offset := r.Start
+
+	for block := (r.Start + b.BlockSize - 1) / b.BlockSize; block < uint64(len(b.Sums)); block++ {
+		blockStart := block * b.BlockSize
+
+		blockStop := blockStart + b.BlockSize - 1
+		if blockStop >= size {
+			blockStop = size - 1
+		}
+
+		if blockStart >= size || blockStop > r.Stop {
+			return nil
+		}
+
+		if _, err := io.CopyN(io.Discard, data, int64(blockStart-offset)); err != nil {
+			return err
+		}
+
+		h := b.NewHash()
+		if _, err := io.CopyN(h, data, int64(blockStop-blockStart+1)); err != nil {
+			return err
+		}
+
+		if actual := h.Sum(nil); !bytes.Equal(actual, b.Sums[block]) {
+			return fmt.Errorf("%w: block %d (bytes %d-%d) expected %x, got %x",
+				ErrChunkMismatch, block, blockStart, blockStop, b.Sums[block], actual)
+		}
+
+		offset = blockStop + 1
+	}
+
+	return nil
+}
+
+// verifyChunk checks the completed chunk c of a file of size bytes with
+// opts.ChunkVerifier, reading it back from where asm wrote it. A corrupt chunk
+// is emptied, so the next attempt fetches it from the start.
+func verifyChunk(opts Options, asm Assembler, progress io.Writer, c *chunk, size uint64) error {
+	src, ok := assemblerSource(asm)
+	if opts.ChunkVerifier == nil || !ok {
+		return nil
+	}
+
+	data := io.NewSectionReader(src, int64(c.Start), int64(c.size()))
+
+	err := opts.ChunkVerifier.VerifyChunk(Range{Start: c.Start, Stop: c.Stop}, size, data)
+	if err == nil {
+		return nil
+	}
+
+	written := atomic.SwapUint64(&c.Written, 0)
+
+	if p, ok := progress.(*progressWriter); ok {
+		p.rewind(written)
+	}
+
+	return err
+}
+
+// repairChunks verifies the length of the assembled partialFileName and its
+// content against the checksum and the server's digest. On a mismatch it
+// fetches the suspect chunks again, up to opts.VerifyRetries times. The
+// mismatch is returned when no chunk is suspect.
+func repairChunks(
+	ctx context.Context,
+	opts Options,
+	partialFileName, fileName string,
+	size uint64,
+	chunks []*chunk,
+	mirrors []mirror,
+) error {
+	opts, err := listedChecksum(fileName, opts)
+	if err != nil {
+		return err
+	}
+
+	// The partial file is removed by the caller once the repair gave up.
+	opts.RemovePartial = false
+
+	for attempt := 0; ; attempt++ {
+		err := verifyLength(partialFileName, size, opts)
+		if err == nil {
+			_, err = verifyContent(partialFileName, fileName, opts)
+		}
+
+		repairable := errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrLengthMismatch)
+		if err == nil || attempt >= opts.VerifyRetries || !repairable {
+			return err
+		}
+
+		file, openErr := os.OpenFile(partialFileName, os.O_RDWR, 0)
+		if openErr != nil {
+			return openErr
+		}
+
+		suspects, findErr := suspectChunks(opts, file, size, chunks)
+
+		// A file cut short gets its size back, so the chunks fetched again
+		// land at their offsets.
+		if findErr == nil && len(suspects) > 0 {
+			findErr = file.Truncate(int64(size))
+		}
+
+		if findErr != nil || len(suspects) == 0 {
+			_ = file.Close()
+
+			return errors.Join(err, findErr)
+		}
+
+		for _, c := range suspects {
+			atomic.StoreUint64(&c.Written, 0)
+		}
+
+		fmt.Fprintf(opts.progressOutput(), "\nFetching %d suspect chunks again...", len(suspects))
+		opts.logger().Info("repairing download", "file", fileName, "chunks", len(suspects), "attempt", attempt+1, "error", err)
+
+		err = downloadChunks(ctx, opts, opts.fileAssembler(file, false), io.Discard, suspects, mirrors)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// suspectChunks picks the chunks of the assembled file whose bytes are likely
+// bad, in the order of chunks, which have to be sorted by offset. Suspects
+// are the chunks reaching past the end of a file cut short, those
+// opts.ChunkVerifier finds corrupt on their own, and both chunks around a
+// boundary it only finds corrupt when checking them together. Verifiers like
+// BlockChecksums don't check a block that no single chunk covers completely,
+// so such a block is only checked once its chunks are assembled.
+func suspectChunks(opts Options, file *os.File, size uint64, chunks []*chunk) ([]*chunk, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fileSize := uint64(info.Size())
+	suspect := make([]bool, len(chunks))
+
+	for i, c := range chunks {
+		if c.Stop >= fileSize {
+			suspect[i] = true
+
+			continue
+		}
+
+		if suspect[i], err = rangeCorrupt(opts, file, size, Range{Start: c.Start, Stop: c.Stop}); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 1; i < len(chunks); i++ {
+		a, b := chunks[i-1], chunks[i]
+		if suspect[i-1] || suspect[i] {
+			continue
+		}
+
+		corrupt, err := rangeCorrupt(opts, file, size, Range{Start: a.Start, Stop: b.Stop})
+		if err != nil {
+			return nil, err
+		}
+
+		suspect[i-1], suspect[i] = corrupt, corrupt
+	}
+
+	var suspects []*chunk
+
+	for i, c := range chunks {
+		if suspect[i] {
+			suspects = append(suspects, c)
+		}
+	}
+
+	return suspects, nil
+}
+
+// rangeCorrupt reports whether opts.ChunkVerifier finds r of a file of size
+// bytes corrupt in src. Without a ChunkVerifier nothing is corrupt.
+func rangeCorrupt(opts Options, src io.ReaderAt, size uint64, r Range) (bool, error) {
+	if opts.ChunkVerifier == nil {
+		return false, nil
+	}
+
+	data := io.NewSectionReader(src, int64(r.Start), int64(r.Stop-r.Start+1))
+
+	err := opts.ChunkVerifier.VerifyChunk(r, size, data)
+	if errors.Is(err, ErrChunkMismatch) {
+		return true, nil
+	}
+
+	return false, err
+}
@@ -0,0 +1,268 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockSums returns the sha256 digests of the blockSize blocks of content in
+// the format ParseBlockChecksums reads.
+func blockSums(content []byte, blockSize int) string {
+	var b strings.Builder
+
+	for start := 0; start < len(content); start += blockSize {
+		stop := start + blockSize
+		if stop > len(content) {
+			stop = len(content)
+		}
+
+		fmt.Fprintf(&b, "%x  block%d\n", sha256.Sum256(content[start:stop]), start/blockSize)
+	}
+
+	return b.String()
+}
+
+func TestBlockChecksums(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 25)
+
+	sums, err := ParseBlockChecksums(strings.NewReader("# blocks of 100 bytes\n\n"+blockSums(content, 100)), "sha256", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := bytes.Clone(content)
+	corrupt[150] = 'x'
+
+	cases := []struct {
+		data     []byte
+		r        Range
+		mismatch bool
+	}{
+		{content, Range{0, 249}, false},
+		{corrupt, Range{0, 249}, true},
+		{corrupt, Range{100, 199}, true},
+		{corrupt, Range{200, 249}, false},
+		// Block 1 is only partly covered, so it isn't checked.
+		{corrupt, Range{120, 249}, false},
+		{corrupt, Range{0, 170}, false},
+	}
+
+	for _, testCase := range cases {
+		data := bytes.NewReader(testCase.data[testCase.r.Start : testCase.r.Stop+1])
+
+		err := sums.VerifyChunk(testCase.r, uint64(len(content)), data)
+		if errors.Is(err, ErrChunkMismatch) != testCase.mismatch {
+			t.Errorf("Failed %+v: %v \n", testCase.r, err)
+		}
+	}
+
+	if _, err := ParseBlockChecksums(strings.NewReader("abc\n"), "sha256", 100); err == nil {
+		t.Errorf("Failed invalid digest accepted \n")
+	}
+}
+
+func TestDownloadRefetchesCorruptChunk(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// Whichever server is asked first corrupts the chunk at offset 16384.
+	var corrupted atomic.Int64
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=16384-") && corrupted.Add(1) == 1 {
+			corrupt := bytes.Clone(content)
+			corrupt[20000] ^= 0xff
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(corrupt))
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	})
+
+	primary := httptest.NewServer(handler)
+	defer primary.Close()
+
+	mirror := httptest.NewServer(handler)
+	defer mirror.Close()
+
+	sums, err := ParseBlockChecksums(strings.NewReader(blockSums(content, 8192)), "sha256", 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress uint64
+
+	result, err := Download(context.Background(), primary.URL+"/file.bin", Options{
+		ParallelRequests: 2,
+		ChunkStrategy:    FixedSizeChunks{Size: 16384},
+		ChunkVerifier:    sums,
+		Mirrors:          []string{mirror.URL + "/file.bin"},
+		OutputDir:        t.TempDir(),
+		ProgressFunc:     func(downloaded, total uint64) { progress = downloaded },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+		t.Errorf("Failed corrupt download saved \n")
+	}
+
+	if corrupted.Load() != 2 {
+		t.Errorf("Failed chunk fetched %d times, expected 2 \n", corrupted.Load())
+	}
+
+	if progress != uint64(len(content)) {
+		t.Errorf("Failed progress %d, expected %d \n", progress, len(content))
+	}
+}
+
+func TestDownloadRepairsCorruptChunk(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// Block 1 spans the first two chunks, so neither of them checks it on
+	// its own while downloading.
+	corrupt := bytes.Clone(content)
+	copy(corrupt[12000:], "garbage")
+
+	sums, err := ParseBlockChecksums(strings.NewReader(blockSums(content, 10000)), "sha256", 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, retries := range []int{0, 1} {
+		var (
+			mu        sync.Mutex
+			requested = map[string]int{}
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requested[r.Header.Get("Range")]++
+			first := requested["bytes=0-16383"] == 1
+			mu.Unlock()
+
+			// The first chunk is served corrupt once.
+			if r.Header.Get("Range") == "bytes=0-16383" && first {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(corrupt))
+
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 2,
+			Chunks:           4,
+			Checksum:         fmt.Sprintf("sha256:%x", sha256.Sum256(content)),
+			ChunkVerifier:    sums,
+			VerifyRetries:    retries,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if retries == 0 {
+			if !errors.Is(err, ErrChecksumMismatch) || fileExists(filepath.Join(dir, "file.bin")) {
+				t.Errorf("Failed without retries: %v \n", err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed corrupt chunk not repaired \n")
+		}
+
+		// Only the two chunks around the corrupt block are fetched again.
+		expected := map[string]int{"bytes=0-16383": 2, "bytes=16384-32767": 2, "bytes=32768-49151": 1, "bytes=49152-65535": 1}
+		for r, count := range expected {
+			if requested[r] != count {
+				t.Errorf("Failed %s requested %d times, expected %d \n", r, requested[r], count)
+			}
+		}
+	}
+}
+
+func TestRepairChunksOfShortFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	var requested []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Header.Get("Range"))
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, retries := range []int{0, 1} {
+		requested = nil
+
+		opts, err := Options{
+			ParallelRequests: 1,
+			VerifyRetries:    retries,
+			ProgressOutput:   io.Discard,
+		}.prepare(server.URL + "/file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The file lost its tail after the chunks were written.
+		fileName := filepath.Join(t.TempDir(), "file.bin"+partialFileSuffix)
+		if err := os.WriteFile(fileName, content[:40000], 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		chunks := planChunks(uint64(len(content)), FixedSizeChunks{Size: 16384})
+		for _, c := range chunks {
+			c.Written = c.size()
+		}
+
+		mirrors := []mirror{{url: server.URL + "/file.bin", contentLength: uint64(len(content))}}
+
+		err = repairChunks(context.Background(), opts, fileName, "file.bin", uint64(len(content)), chunks, mirrors)
+
+		if retries == 0 {
+			if !errors.Is(err, ErrLengthMismatch) || len(requested) != 0 {
+				t.Errorf("Failed without retries: %v, %q requested \n", err, requested)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, _ := os.ReadFile(fileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed short file not repaired \n")
+		}
+
+		if len(requested) != 2 || requested[0] != "bytes=32768-49151" || requested[1] != "bytes=49152-65535" {
+			t.Errorf("Failed %q requested, expected only the missing chunks \n", requested)
+		}
+	}
+}
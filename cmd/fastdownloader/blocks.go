@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"fastdownloader"
+)
+
+// loadBlockChecksums reads the -block-checksums flag, "algorithm:file" naming
+// a list of per-block digests of blockSize bytes each.
+func loadBlockChecksums(value string, blockSize uint64) (*fastdownloader.BlockChecksums, error) {
+	algorithm, fileName, found := strings.Cut(value, ":")
+	if !found || fileName == "" {
+		return nil, fmt.Errorf("invalid block checksums %q, expected algorithm:file", value)
+	}
+
+	if blockSize == 0 {
+		return nil, fmt.Errorf("-block-checksums needs -block-size")
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return fastdownloader.ParseBlockChecksums(file, algorithm, blockSize)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBlockChecksums(t *testing.T) {
+	sumsFile := filepath.Join(t.TempDir(), "blocks.sha256")
+
+	err := os.WriteFile(sumsFile, []byte("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  block0\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sums, err := loadBlockChecksums("sha256:"+sumsFile, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sums.Sums) != 1 || sums.BlockSize != 1024 {
+		t.Errorf("Failed %d sums of %d bytes \n", len(sums.Sums), sums.BlockSize)
+	}
+
+	for _, value := range []string{sumsFile, "sha256:", "crc32:" + sumsFile} {
+		if _, err := loadBlockChecksums(value, 1024); err == nil {
+			t.Errorf("Failed %q accepted \n", value)
+		}
+	}
+
+	if _, err := loadBlockChecksums("sha256:"+sumsFile, 0); err == nil {
+		t.Errorf("Failed missing block size accepted \n")
+	}
+}
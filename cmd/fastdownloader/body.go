@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadBody returns the request body of -data or -data-file, or nil when there
+// is none. A -data-file of "-" is read from stdin.
+func loadBody(data, dataFile string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data != "" && dataFile != "":
+		return nil, errors.New("-data and -data-file can't be combined")
+	case data != "":
+		return []byte(data), nil
+	case dataFile == "-":
+		return io.ReadAll(stdin)
+	case dataFile != "":
+		return os.ReadFile(dataFile)
+	}
+
+	return nil, nil
+}
+
+// parseMethod normalizes -method, which may be given in any case.
+func parseMethod(method string) (string, error) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+
+	switch method {
+	case "":
+		return "", nil
+	case http.MethodHead, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return "", errors.New("-method " + method + " doesn't return a file")
+	}
+
+	return method, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBody(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "query.json")
+	if err := os.WriteFile(dataFile, []byte(`{"id":2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		data     string
+		dataFile string
+		expected string
+		noBody   bool
+		invalid  bool
+	}{
+		{"", "", "", true, false},
+		{`{"id":1}`, "", `{"id":1}`, false, false},
+		{"", dataFile, `{"id":2}`, false, false},
+		{"", "-", `{"id":3}`, false, false},
+		{`{"id":1}`, dataFile, "", true, true},
+		{"", filepath.Join(t.TempDir(), "missing"), "", true, true},
+	}
+
+	for _, testCase := range cases {
+		body, err := loadBody(testCase.data, testCase.dataFile, strings.NewReader(`{"id":3}`))
+		if (err != nil) != testCase.invalid {
+			t.Errorf("Failed %q, %q: %v \n", testCase.data, testCase.dataFile, err)
+
+			continue
+		}
+
+		if string(body) != testCase.expected || (body == nil) != testCase.noBody {
+			t.Errorf("Failed %q, %q: %q, expected %q \n", testCase.data, testCase.dataFile, body, testCase.expected)
+		}
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+		invalid  bool
+	}{
+		{"", "", false},
+		{"post", "POST", false},
+		{"PUT", "PUT", false},
+		{"head", "", true},
+	}
+
+	for _, testCase := range cases {
+		method, err := parseMethod(testCase.value)
+		if (err != nil) != testCase.invalid || method != testCase.expected {
+			t.Errorf("Failed %q: %q, %v \n", testCase.value, method, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fastdownloader"
+)
+
+// loadChecksumList reads the sums file of -checksum-file. Without
+// -checksum-algo the algorithm is told by the file name, e.g. SHA256SUMS or
+// file.iso.sha256, or else by the length of the digests.
+func loadChecksumList(fileName, algorithm string) (fastdownloader.ChecksumList, error) {
+	if algorithm == "" {
+		algorithm = checksumAlgorithmFromName(fileName)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return fastdownloader.ParseChecksumList(file, algorithm)
+}
+
+// checksumAlgorithmFromName returns the algorithm a sums file name mentions,
+// or an empty string.
+func checksumAlgorithmFromName(fileName string) string {
+	name := strings.ToLower(filepath.Base(fileName))
+
+	for _, algorithm := range []string{"sha256", "sha1", "md5"} {
+		if strings.Contains(name, algorithm) {
+			return algorithm
+		}
+	}
+
+	return ""
+}
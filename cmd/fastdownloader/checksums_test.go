@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumAlgorithmFromName(t *testing.T) {
+	cases := []struct {
+		fileName string
+		expected string
+	}{
+		{"SHA256SUMS", "sha256"},
+		{"/releases/MD5SUMS", "md5"},
+		{"image.iso.sha1", "sha1"},
+		{"CHECKSUMS", ""},
+	}
+
+	for _, testCase := range cases {
+		if algorithm := checksumAlgorithmFromName(testCase.fileName); algorithm != testCase.expected {
+			t.Errorf("Failed %s: %q, expected %q \n", testCase.fileName, algorithm, testCase.expected)
+		}
+	}
+}
+
+func TestLoadChecksumList(t *testing.T) {
+	dir := t.TempDir()
+
+	// An md5 sized digest in a file named after sha256 is refused, unless
+	// -checksum-algo says otherwise.
+	sums := filepath.Join(dir, "SHA256SUMS")
+	if err := os.WriteFile(sums, []byte("d41d8cd98f00b204e9800998ecf8427e  empty.txt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadChecksumList(sums, ""); err == nil {
+		t.Errorf("Failed an md5 digest was accepted as sha256 \n")
+	}
+
+	list, err := loadChecksumList(sums, "md5")
+	if err != nil || list["empty.txt"] != "md5:d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf("Failed %v, %v \n", list, err)
+	}
+
+	if _, err := loadChecksumList(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Errorf("Failed a missing file was accepted \n")
+	}
+}
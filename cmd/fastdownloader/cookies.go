@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"fastdownloader"
+)
+
+// loadCookies builds the cookies of the -cookie and -cookie-file flags. Every
+// -cookie value holds one or more "name=value" pairs separated by semicolons.
+func loadCookies(values []string, cookieFile string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ";") {
+			name, cookieValue, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || name == "" {
+				return nil, fmt.Errorf("invalid cookie %q, expected \"name=value\"", pair)
+			}
+
+			cookies = append(cookies, &http.Cookie{Name: name, Value: cookieValue})
+		}
+	}
+
+	if cookieFile != "" {
+		file, err := os.Open(cookieFile)
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() { _ = file.Close() }()
+
+		fileCookies, err := fastdownloader.ParseCookieFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		cookies = append(cookies, fileCookies...)
+	}
+
+	return cookies, nil
+}
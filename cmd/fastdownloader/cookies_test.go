@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCookies(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+
+	err := os.WriteFile(cookieFile, []byte(".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies, err := loadCookies([]string{"a=1", "b=2; c="}, cookieFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a=1", "b=2", "c=", "session=abc"}
+
+	if len(cookies) != len(expected) {
+		t.Fatalf("Failed %d cookies, expected %d \n", len(cookies), len(expected))
+	}
+
+	for i, cookie := range cookies {
+		if pair := cookie.Name + "=" + cookie.Value; pair != expected[i] {
+			t.Errorf("Failed cookie %d: %s != %s \n", i, pair, expected[i])
+		}
+	}
+
+	if _, err := loadCookies([]string{"novalue"}, ""); err == nil {
+		t.Errorf("Failed invalid cookie accepted \n")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// parseHeaderFile reads "Key: Value" lines like an HTTP header block. Blank
+// lines and lines starting with # are skipped; a key may repeat.
+func parseHeaderFile(r io.Reader) (http.Header, error) {
+	header := http.Header{}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("headers file line %d: invalid header %q, expected \"Key: Value\"", lineNumber, line)
+		}
+
+		header.Add(key, strings.TrimSpace(value))
+	}
+
+	return header, scanner.Err()
+}
+
+// loadHeaders merges the headers of -headers-file with those of -header,
+// which replace file headers of the same name.
+func loadHeaders(headersFile string, flagHeaders http.Header) (http.Header, error) {
+	if headersFile == "" {
+		return flagHeaders, nil
+	}
+
+	file, err := os.Open(headersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	header, err := parseHeaderFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range flagHeaders {
+		header[key] = values
+	}
+
+	return header, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeaderFile(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected http.Header
+		fail     bool
+	}{
+		{
+			"# secrets\nAuthorization: Bearer abc\r\n\nx-trace: 1\nX-Trace: 2\nX-Empty:\n",
+			http.Header{"Authorization": {"Bearer abc"}, "X-Trace": {"1", "2"}, "X-Empty": {""}},
+			false,
+		},
+		{"Accept: */*\nno colon here\n", nil, true},
+		{": value\n", nil, true},
+		{"Bad Key: value\n", nil, true},
+		{" Folded: value\n", nil, true},
+	}
+
+	for _, testCase := range cases {
+		header, err := parseHeaderFile(strings.NewReader(testCase.input))
+		if (err != nil) != testCase.fail {
+			t.Errorf("Failed %q: %v \n", testCase.input, err)
+
+			continue
+		}
+
+		if !testCase.fail && !reflect.DeepEqual(header, testCase.expected) {
+			t.Errorf("Failed %q: %v != %v \n", testCase.input, header, testCase.expected)
+		}
+	}
+}
+
+func TestLoadHeaders(t *testing.T) {
+	headersFile := filepath.Join(t.TempDir(), "headers.txt")
+
+	err := os.WriteFile(headersFile, []byte("Authorization: Bearer file\nAccept: text/plain\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := loadHeaders(headersFile, http.Header{"Authorization": {"Bearer flag"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := http.Header{"Authorization": {"Bearer flag"}, "Accept": {"text/plain"}}
+	if !reflect.DeepEqual(header, expected) {
+		t.Errorf("Failed %v != %v \n", header, expected)
+	}
+}
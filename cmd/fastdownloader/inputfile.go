@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// inputEntry is a URL to download with an optional output file name.
+type inputEntry struct {
+	url    string
+	output string
+}
+
+// parseInputFile reads one URL per line. Blank lines and lines starting with
+// # are ignored, and an output file name may follow the URL after a tab.
+func parseInputFile(r io.Reader) ([]inputEntry, error) {
+	var (
+		entries []inputEntry
+		lineNo  int
+	)
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := scanner.Text()
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+
+		entry := inputEntry{url: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			entry.output = strings.TrimSpace(parts[1])
+		}
+
+		if entry.url == "" || strings.ContainsAny(entry.url, " \t") {
+			return nil, fmt.Errorf("line %d: invalid url %q", lineNo, entry.url)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func readInputFile(fileName string) ([]inputEntry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return parseInputFile(file)
+}
+
+// entryName is the short name an entry's progress is shown under while
+// several files download at once: its output name, or the last segment of
+// its URL path.
+func entryName(entry inputEntry) string {
+	if entry.output != "" {
+		return entry.output
+	}
+
+	if u, err := url.Parse(entry.url); err == nil {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			return name
+		}
+	}
+
+	return entry.url
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseInputFile(t *testing.T) {
+	input := strings.Join([]string{
+		"# release manifest",
+		"https://example.com/a.zip",
+		"",
+		"   ",
+		"https://example.com/b.zip\tcustom-b.zip",
+		"  # indented comment",
+		"https://example.com/c.zip\t",
+	}, "\n")
+
+	entries, err := parseInputFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []inputEntry{
+		{url: "https://example.com/a.zip"},
+		{url: "https://example.com/b.zip", output: "custom-b.zip"},
+		{url: "https://example.com/c.zip"},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Failed %d entries, expected %d \n", len(entries), len(expected))
+	}
+
+	for i, entry := range entries {
+		if entry != expected[i] {
+			t.Errorf("Failed %+v != %+v \n", entry, expected[i])
+		}
+	}
+}
+
+func TestParseInputFileInvalidLine(t *testing.T) {
+	for _, input := range []string{"\tonly-output.zip", "https://example.com/a b.zip"} {
+		if _, err := parseInputFile(strings.NewReader(input)); err == nil {
+			t.Errorf("Failed %q accepted \n", input)
+		}
+	}
+}
+
+func TestEntryName(t *testing.T) {
+	cases := []struct {
+		entry    inputEntry
+		expected string
+	}{
+		{inputEntry{url: "https://example.com/dir/a.zip?x=1"}, "a.zip"},
+		{inputEntry{url: "https://example.com/a.zip", output: "custom.zip"}, "custom.zip"},
+		{inputEntry{url: "https://example.com/"}, "https://example.com/"},
+		{inputEntry{url: "https://example.com"}, "https://example.com"},
+	}
+
+	for _, testCase := range cases {
+		if name := entryName(testCase.entry); name != testCase.expected {
+			t.Errorf("Failed %+v: %q != %q \n", testCase.entry, name, testCase.expected)
+		}
+	}
+}
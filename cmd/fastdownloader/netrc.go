@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"fastdownloader"
+)
+
+// loadNetrc reads the credentials of -netrc-file, or with -netrc those of
+// $NETRC or ~/.netrc, which may be missing like with curl.
+func loadNetrc(useNetrc bool, netrcFile string) (*fastdownloader.Netrc, error) {
+	fileName, optional := netrcFile, false
+
+	if fileName == "" {
+		if !useNetrc {
+			return nil, nil
+		}
+
+		fileName, optional = os.Getenv("NETRC"), true
+
+		if fileName == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+
+			fileName = filepath.Join(home, ".netrc")
+		}
+	}
+
+	file, err := os.Open(fileName)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return fastdownloader.ParseNetrc(file)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadNetrc(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("NETRC", "")
+
+	// Without a ~/.netrc, -netrc is a no-op.
+	if netrc, err := loadNetrc(true, ""); netrc != nil || err != nil {
+		t.Errorf("Failed missing ~/.netrc: %v, %v \n", netrc, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".netrc"), []byte("machine example.com login alice password secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		useNetrc  bool
+		netrcFile string
+		loaded    bool
+		invalid   bool
+	}{
+		{false, "", false, false},
+		{true, "", true, false},
+		{false, filepath.Join(home, ".netrc"), true, false},
+		// An explicit file has to exist.
+		{false, filepath.Join(home, "missing"), false, true},
+	}
+
+	for _, testCase := range cases {
+		netrc, err := loadNetrc(testCase.useNetrc, testCase.netrcFile)
+		if (err != nil) != testCase.invalid || (netrc != nil) != testCase.loaded {
+			t.Errorf("Failed %t %q: %v, %v \n", testCase.useNetrc, testCase.netrcFile, netrc, err)
+		}
+	}
+}
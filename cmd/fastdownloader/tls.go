@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// loadTLSConfig builds the TLS settings for the -ca-cert, -client-cert,
+// -client-key and -insecure flags. It returns nil when none of them is set so
+// the default settings apply.
+func loadTLSConfig(caCert, clientCert, clientKey string, insecure bool) (*tls.Config, error) {
+	if caCert == "" && clientCert == "" && clientKey == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: insecure, //nolint:gosec
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if (clientCert == "") != (clientKey == "") {
+		return nil, errors.New("-client-cert and -client-key must be used together")
+	}
+
+	if clientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
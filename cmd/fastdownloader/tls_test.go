@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	caCert := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	notPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		caCert     string
+		clientCert string
+		clientKey  string
+		insecure   bool
+		isNil      bool
+		shouldFail bool
+	}{
+		{"", "", "", false, true, false},
+		{caCert, "", "", false, false, false},
+		{"", "", "", true, false, false},
+		{notPEM, "", "", false, true, true},
+		{"", caCert, "", false, true, true},
+		{filepath.Join(dir, "missing.pem"), "", "", false, true, true},
+	}
+
+	for _, testCase := range cases {
+		config, err := loadTLSConfig(testCase.caCert, testCase.clientCert, testCase.clientKey, testCase.insecure)
+
+		if (err != nil) != testCase.shouldFail {
+			t.Errorf("Failed %+v: unexpected error %v \n", testCase, err)
+		}
+
+		if (config == nil) != testCase.isNil {
+			t.Errorf("Failed %+v: config %+v \n", testCase, config)
+		}
+
+		if config != nil && config.InsecureSkipVerify != testCase.insecure {
+			t.Errorf("Failed %+v: InsecureSkipVerify %t \n", testCase, config.InsecureSkipVerify)
+		}
+
+		if config != nil && testCase.caCert != "" && config.RootCAs == nil {
+			t.Errorf("Failed %+v: CA pool not set \n", testCase)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package fastdownloader
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var errUnsupportedCharset = errors.New("unsupported charset")
+
+// contentDispositionFilename returns the file name of a Content-Disposition
+// header. An RFC 5987 encoded filename* parameter is preferred over the plain
+// filename parameter; when its charset is unsupported the plain one is used.
+func contentDispositionFilename(contentDisposition string) (string, error) {
+	_, params, err := mime.ParseMediaType(contentDisposition)
+	if err != nil {
+		return "", err
+	}
+
+	if extValue, ok := extendedFilenameParam(contentDisposition); ok {
+		if filename, err := decodeExtValue(extValue); err == nil {
+			return filename, nil
+		}
+	}
+
+	return params["filename"], nil
+}
+
+// extendedFilenameParam finds the raw filename* parameter. mime.ParseMediaType
+// silently drops it for charsets other than UTF-8 and US-ASCII.
+func extendedFilenameParam(contentDisposition string) (string, bool) {
+	for _, param := range strings.Split(contentDisposition, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found && strings.EqualFold(strings.TrimSpace(key), "filename*") {
+			return strings.TrimSpace(value), true
+		}
+	}
+
+	return "", false
+}
+
+// decodeExtValue decodes an RFC 5987 ext-value: charset'language'pct-encoded.
+func decodeExtValue(value string) (string, error) {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid ext-value %q", value)
+	}
+
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		if !utf8.ValidString(decoded) {
+			return "", fmt.Errorf("invalid utf-8 in %q", value)
+		}
+
+		return decoded, nil
+	case "iso-8859-1":
+		// ISO-8859-1 bytes map one to one onto the first 256 code points.
+		runes := make([]rune, len(decoded))
+		for i := 0; i < len(decoded); i++ {
+			runes[i] = rune(decoded[i])
+		}
+
+		return string(runes), nil
+	case "us-ascii":
+		for i := 0; i < len(decoded); i++ {
+			if decoded[i] >= utf8.RuneSelf {
+				return "", fmt.Errorf("invalid us-ascii in %q", value)
+			}
+		}
+
+		return decoded, nil
+	default:
+		return "", fmt.Errorf("%w %q", errUnsupportedCharset, parts[0])
+	}
+}
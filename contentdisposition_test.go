@@ -0,0 +1,32 @@
+package fastdownloader
+
+import (
+	"testing"
+)
+
+func TestContentDispositionFilename(t *testing.T) {
+	cases := []struct {
+		contentDisposition string
+		expected           string
+	}{
+		{`attachment; filename="plain.txt"`, "plain.txt"},
+		{`attachment; filename*=UTF-8''%e6%96%87.txt`, "文.txt"},
+		{`attachment; filename="fallback.txt"; filename*=UTF-8''%e6%96%87.txt`, "文.txt"},
+		{`attachment; filename*=utf-8'en'na%C3%AFve.txt; filename="naive.txt"`, "naïve.txt"},
+		{`attachment; filename*=ISO-8859-1''%e9t%e9.txt`, "été.txt"},
+		{`attachment; filename="ete.txt"; filename*=iso-8859-1''%e9t%e9.txt`, "été.txt"},
+		{`attachment; filename="ascii.txt"; filename*=KOI8-R''%c1.txt`, "ascii.txt"},
+		{`attachment`, ""},
+	}
+
+	for _, testCase := range cases {
+		filename, err := contentDispositionFilename(testCase.contentDisposition)
+		if err != nil {
+			t.Errorf("Failed %s: %v \n", testCase.contentDisposition, err)
+		}
+
+		if filename != testCase.expected {
+			t.Errorf("Failed %s: %q != %q \n", testCase.contentDisposition, filename, testCase.expected)
+		}
+	}
+}
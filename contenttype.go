@@ -0,0 +1,56 @@
+package fastdownloader
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrUnexpectedContentType is returned when the Content-Type of a response
+// doesn't match Options.ExpectType. Nothing is written in that case.
+var ErrUnexpectedContentType = errors.New("unexpected Content-Type")
+
+// parseExpectedTypes splits an Options.ExpectType into its media types, e.g.
+// "application/zip, image/*".
+func parseExpectedTypes(value string) ([]string, error) {
+	var types []string
+
+	for _, pattern := range strings.Split(value, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(pattern))
+		if err != nil || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("invalid expected type %q, expected e.g. application/zip or image/*", pattern)
+		}
+
+		types = append(types, mediaType)
+	}
+
+	return types, nil
+}
+
+// checkContentType fails a response whose Content-Type, without parameters,
+// matches none of opts.ExpectType. A type ending in /* matches every subtype.
+// A missing Content-Type doesn't match either.
+func checkContentType(header http.Header, opts Options) error {
+	if opts.ExpectType == "" {
+		return nil
+	}
+
+	// The types were validated by prepare.
+	types, _ := parseExpectedTypes(opts.ExpectType)
+
+	contentType := header.Get("Content-Type")
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		for _, expected := range types {
+			prefix, wildcard := strings.CutSuffix(expected, "*")
+
+			if mediaType == expected || expected == "*/*" || (wildcard && strings.HasPrefix(mediaType, prefix)) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: got %q, expected %s", ErrUnexpectedContentType, contentType, opts.ExpectType)
+}
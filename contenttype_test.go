@@ -0,0 +1,119 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    string
+		matches     bool
+	}{
+		{"application/zip", "application/zip", true},
+		{"Application/ZIP", "application/zip", true},
+		{"text/html; charset=utf-8", "text/html", true},
+		{"text/html; charset=utf-8", "application/zip", false},
+		{"image/png", "image/*", true},
+		{"image/svg+xml", "image/*", true},
+		{"application/png", "image/*", false},
+		{"text/html", "*/*", true},
+		{"application/octet-stream", "application/zip, application/octet-stream", true},
+		{"", "application/zip", false},
+		{"not a type", "application/zip", false},
+	}
+
+	for _, testCase := range cases {
+		header := http.Header{}
+		if testCase.contentType != "" {
+			header.Set("Content-Type", testCase.contentType)
+		}
+
+		err := checkContentType(header, Options{ExpectType: testCase.expected})
+		if (err == nil) != testCase.matches || (err != nil && !errors.Is(err, ErrUnexpectedContentType)) {
+			t.Errorf("Failed %q for %q: %v \n", testCase.contentType, testCase.expected, err)
+		}
+	}
+}
+
+func TestParseExpectedTypes(t *testing.T) {
+	for _, value := range []string{"zip", "application/zip,", "application/zip;;"} {
+		if _, err := parseExpectedTypes(value); err == nil {
+			t.Errorf("Failed %q accepted \n", value)
+		}
+	}
+}
+
+func TestDownloadExpectType(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	page := []byte("<html><body>Please log in</body></html>")
+
+	cases := []struct {
+		name         string
+		expectType   string
+		html         bool
+		acceptRanges bool
+		size         uint64
+		fails        bool
+	}{
+		{"matching", "application/zip", false, true, 0, false},
+		{"wildcard", "application/*", false, true, 0, false},
+		{"login page", "application/zip", true, false, 0, true},
+		{"login page with ranges", "application/zip", true, true, 0, true},
+		// A size hint skips the probe, so a range response is checked.
+		{"login page with a size hint", "application/zip", true, true, uint64(len(page)), true},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := content
+			w.Header().Set("Content-Type", "application/zip")
+
+			if testCase.html {
+				body = page
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			}
+
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.zip", time.Time{}, bytes.NewReader(body))
+
+				return
+			}
+
+			_, _ = w.Write(body)
+		}))
+
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.zip", Options{
+			Chunks:         4,
+			ExpectType:     testCase.expectType,
+			ExpectedSize:   testCase.size,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if testCase.fails != errors.Is(err, ErrUnexpectedContentType) || (!testCase.fails && err != nil) {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		entries, _ := os.ReadDir(dir)
+		if testCase.fails && len(entries) != 0 {
+			t.Errorf("Failed %s: %d files written \n", testCase.name, len(entries))
+		}
+
+		if !testCase.fails && len(entries) != 1 {
+			t.Errorf("Failed %s: %d files written \n", testCase.name, len(entries))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// errPaused ends the read of a range request whose connection is closed
+// while a Controller is paused. The chunk continues with a new request once
+// it is resumed.
+var errPaused = errors.New("download paused")
+
+// PausePolicy decides what a paused Controller does with the open
+// connections of a download.
+type PausePolicy int
+
+const (
+	// HoldConnections keeps the connections open and stops reading from
+	// them until the download is resumed, which stalls the server through
+	// TCP flow control. Servers may drop connections held for long; those
+	// are retried like any other failure.
+	HoldConnections PausePolicy = iota
+
+	// CloseConnections closes the connections of a parallel download, whose
+	// chunks continue with new range requests from where they stopped once
+	// resumed. A single request download can't continue that way and holds
+	// its connection instead.
+	CloseConnections
+)
+
+// Controller pauses and resumes a running download, e.g. from a GUI. Pass it
+// as Options.Controller; it may be shared by several downloads, which are then
+// paused together. It is safe for concurrent use.
+type Controller struct {
+	policy PausePolicy
+
+	mu sync.Mutex
+
+	// resumed is closed by Resume; it is nil while the download runs.
+	resumed chan struct{}
+}
+
+// NewController returns a running Controller that handles the connections of
+// a paused download according to policy.
+func NewController(policy PausePolicy) *Controller {
+	return &Controller{policy: policy}
+}
+
+// Pause stops the download from reading any further data.
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues a paused download.
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+// Paused reports whether the download is paused.
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.resumed != nil
+}
+
+// wait blocks while the download is paused, or until ctx is done.
+func (c *Controller) wait(ctx context.Context) error {
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pausedReader holds every read while its Controller is paused. A reader
+// that may release its connection fails with errPaused instead when the
+// Controller closes connections.
+type pausedReader struct {
+	ctx        context.Context
+	reader     io.Reader
+	controller *Controller
+	release    bool
+}
+
+func (r *pausedReader) Read(p []byte) (int, error) {
+	if r.release && r.controller.policy == CloseConnections && r.controller.Paused() {
+		return 0, errPaused
+	}
+
+	if err := r.controller.wait(r.ctx); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
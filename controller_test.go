@@ -0,0 +1,142 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowReader serves its content 4 KiB per millisecond, so a download runs
+// long enough to be paused.
+type slowReader struct {
+	reader *bytes.Reader
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+
+	return r.reader.Read(p)
+}
+
+func (r slowReader) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
+}
+
+// countingSink collects a download in memory and counts the bytes written.
+type countingSink struct {
+	mu      sync.Mutex
+	data    []byte
+	written atomic.Int64
+}
+
+func (s *countingSink) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(s.data) {
+		s.data = append(s.data, make([]byte, end-len(s.data))...)
+	}
+
+	copy(s.data[off:], p)
+	s.written.Add(int64(len(p)))
+
+	return len(p), nil
+}
+
+func TestControllerPause(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+	cases := []struct {
+		name         string
+		policy       PausePolicy
+		acceptRanges bool
+	}{
+		{"hold", HoldConnections, true},
+		{"close", CloseConnections, true},
+		// A single request can't be resumed with a new one and is held.
+		{"close serial", CloseConnections, false},
+	}
+
+	for _, testCase := range cases {
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				requests.Add(1)
+			}
+
+			if !testCase.acceptRanges {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				_, _ = io.Copy(w, slowReader{bytes.NewReader(content)})
+
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, slowReader{bytes.NewReader(content)})
+		}))
+
+		controller := NewController(testCase.policy)
+		sink := &countingSink{}
+
+		done := make(chan error, 1)
+
+		go func() {
+			_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+				ParallelRequests: 4,
+				Controller:       controller,
+				Sink:             sink,
+				ProgressOutput:   io.Discard,
+			})
+			done <- err
+		}()
+
+		for sink.written.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		controller.Pause()
+
+		// Reads that were under way when it paused may still land.
+		time.Sleep(50 * time.Millisecond)
+
+		paused := sink.written.Load()
+
+		time.Sleep(200 * time.Millisecond)
+
+		if written := sink.written.Load(); written != paused {
+			t.Errorf("Failed %s: %d bytes written while paused \n", testCase.name, written-paused)
+		}
+
+		if paused == int64(len(content)) {
+			t.Errorf("Failed %s: download finished before the pause \n", testCase.name)
+		}
+
+		controller.Resume()
+
+		if err := <-done; err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		server.Close()
+
+		if !bytes.Equal(sink.data, content) {
+			t.Errorf("Failed %s: %d bytes downloaded, expected %d \n", testCase.name, len(sink.data), len(content))
+		}
+
+		// Closed connections are replaced by a new request per chunk.
+		if reconnected := requests.Load() > 5; reconnected != (testCase.policy == CloseConnections && testCase.acceptRanges) {
+			t.Errorf("Failed %s: %d requests \n", testCase.name, requests.Load())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package fastdownloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in a cookies.txt file, hiding them
+// from parsers that skip comments.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// ParseCookieFile reads cookies in the Netscape cookies.txt format written by
+// browser extensions, curl and wget: one cookie per line with the tab
+// separated fields domain, include subdomains, path, secure, expiry, name and
+// value. A zero expiry is a session cookie. The include subdomains flag isn't
+// kept, so every cookie also applies to the subdomains of its domain.
+func ParseCookieFile(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookie file line %d: expected 7 tab separated fields, got %d", lineNumber, len(fields))
+		}
+
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookie file line %d: invalid expiry %q", lineNumber, fields[4])
+		}
+
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Domain:   strings.TrimPrefix(fields[0], "."),
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+
+		cookies = append(cookies, cookie)
+	}
+
+	return cookies, scanner.Err()
+}
+
+// cookieJar returns jar, or a new one when it is nil, with cookies added.
+// Cookies without a domain belong to the host of downloadURL.
+func cookieJar(jar http.CookieJar, downloadURL string, cookies []*http.Cookie) (http.CookieJar, error) {
+	if jar == nil {
+		var err error
+		if jar, err = cookiejar.New(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	target, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cookie := range cookies {
+		cookieURL := &url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/"}
+
+		if cookie.Domain != "" {
+			cookieURL.Host = cookie.Domain
+		}
+
+		if cookie.Secure {
+			cookieURL.Scheme = "https"
+		}
+
+		jar.SetCookies(cookieURL, []*http.Cookie{cookie})
+	}
+
+	return jar, nil
+}
@@ -0,0 +1,115 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cookieServer serves content only to requests carrying the session cookie.
+// /login sets the cookie and redirects to the file.
+func cookieServer(content []byte, rejected *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret", Path: "/"})
+			http.Redirect(w, r, "/file.bin", http.StatusFound)
+
+			return
+		}
+
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "secret" {
+			rejected.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestDownloadWithCookies(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	cases := []struct {
+		name    string
+		path    string
+		cookies []*http.Cookie
+	}{
+		{"cookie option", "/file.bin", []*http.Cookie{{Name: "session", Value: "secret"}}},
+		{"cookie set by a redirect", "/login", nil},
+	}
+
+	for _, testCase := range cases {
+		var rejected atomic.Int64
+
+		server := cookieServer(content, &rejected)
+
+		result, err := Download(context.Background(), server.URL+testCase.path, Options{
+			Chunks:         4,
+			Cookies:        testCase.cookies,
+			OutputDir:      t.TempDir(),
+			HTTPClient:     server.Client(),
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+
+			continue
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: %d bytes saved, expected %d \n", testCase.name, len(data), len(content))
+		}
+
+		if rejected.Load() != 0 {
+			t.Errorf("Failed %s: %d requests without the cookie \n", testCase.name, rejected.Load())
+		}
+	}
+}
+
+func TestParseCookieFile(t *testing.T) {
+	input := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc",
+		"#HttpOnly_files.example.com\tFALSE\t/dl\tTRUE\t2000000000\ttoken\txyz",
+	}, "\n")
+
+	cookies, err := ParseCookieFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []http.Cookie{
+		{Name: "session", Value: "abc", Path: "/", Domain: "example.com"},
+		{
+			Name: "token", Value: "xyz", Path: "/dl", Domain: "files.example.com",
+			Secure: true, HttpOnly: true, Expires: time.Unix(2000000000, 0),
+		},
+	}
+
+	if len(cookies) != len(expected) {
+		t.Fatalf("Failed %d cookies, expected %d \n", len(cookies), len(expected))
+	}
+
+	for i, cookie := range cookies {
+		if cookie.String() != expected[i].String() || cookie.HttpOnly != expected[i].HttpOnly {
+			t.Errorf("Failed cookie %d: %+v != %+v \n", i, *cookie, expected[i])
+		}
+	}
+
+	if _, err := ParseCookieFile(strings.NewReader("example.com\tTRUE\t/\n")); err == nil {
+		t.Errorf("Failed malformed line accepted \n")
+	}
+}
@@ -0,0 +1,109 @@
+package fastdownloader
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	digestHeader        = "Digest"
+	contentDigestHeader = "Content-Digest"
+)
+
+// digestAlgorithms maps the algorithm names of Digest (RFC 3230) and
+// Content-Digest (RFC 9530) fields to checksumAlgorithms, strongest first.
+var digestAlgorithms = []struct {
+	name      string
+	algorithm string
+}{
+	{"sha-256", "sha256"},
+	{"sha", "sha1"},
+	{"md5", "md5"},
+}
+
+// serverDigest returns the strongest supported digest announced by the
+// Content-Digest or Digest field of headers, e.g. the header and trailer of a
+// response, or nil when there is none. The first headers take precedence.
+func serverDigest(opts Options, headers ...http.Header) *checksum {
+	for _, header := range headers {
+		for _, name := range []string{contentDigestHeader, digestHeader} {
+			value := header.Get(name)
+			if value == "" {
+				continue
+			}
+
+			digest, err := parseDigest(value)
+			if err != nil {
+				opts.logger().Info("ignoring "+name, "value", value, "error", err)
+
+				continue
+			}
+
+			if digest != nil {
+				return digest
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseDigest parses a Digest value such as "SHA-256=base64,MD5=base64" or a
+// Content-Digest value such as "sha-256=:base64:". It returns the strongest
+// supported digest, or nil when the value only lists unsupported ones.
+func parseDigest(value string) (*checksum, error) {
+	digests := map[string]string{}
+
+	for _, member := range strings.Split(value, ",") {
+		name, encoded, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid digest %q, expected algorithm=value", member)
+		}
+
+		// Content-Digest wraps the value in colons and may add parameters.
+		encoded, _, _ = strings.Cut(encoded, ";")
+		digests[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(encoded), ":")
+	}
+
+	for _, a := range digestAlgorithms {
+		encoded, ok := digests[a.name]
+		if !ok {
+			continue
+		}
+
+		expected, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s digest %q: %w", a.name, encoded, err)
+		}
+
+		newHash := checksumAlgorithms[a.algorithm]
+		if len(expected) != newHash().Size() {
+			return nil, fmt.Errorf("invalid %s digest length %d", a.name, len(expected))
+		}
+
+		return &checksum{algorithm: a.algorithm, newHash: newHash, expected: expected}, nil
+	}
+
+	return nil, nil
+}
+
+// pendingDigest returns opts.digest unless Options.Checksum already covers
+// it. A digest contradicting Options.Checksum fails without hashing the file.
+func pendingDigest(opts Options) (*checksum, error) {
+	digest := opts.digest
+	if digest == nil {
+		return nil, nil
+	}
+
+	if c := opts.checksum; c != nil && c.algorithm == digest.algorithm {
+		if c.String() == digest.String() {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: the server's digest %s contradicts the expected %s", ErrChecksumMismatch, digest, c)
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,155 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDigest(t *testing.T) {
+	sha := sha256.Sum256([]byte("content"))
+	sum := md5.Sum([]byte("content")) //nolint:gosec
+	sha256Digest := base64.StdEncoding.EncodeToString(sha[:])
+	md5Digest := base64.StdEncoding.EncodeToString(sum[:])
+
+	cases := []struct {
+		value    string
+		expected string
+		invalid  bool
+	}{
+		{"SHA-256=" + sha256Digest, "sha256:" + hex.EncodeToString(sha[:]), false},
+		{"sha-256=:" + sha256Digest + ":", "sha256:" + hex.EncodeToString(sha[:]), false},
+		// The strongest supported algorithm wins.
+		{"MD5=" + md5Digest + ", SHA-256=" + sha256Digest, "sha256:" + hex.EncodeToString(sha[:]), false},
+		{"UNIXsum=30637, MD5=" + md5Digest, "md5:" + hex.EncodeToString(sum[:]), false},
+		{"UNIXsum=30637", "", false},
+		{"SHA-256=not base64", "", true},
+		{"SHA-256=" + md5Digest, "", true},
+		{"SHA-256", "", true},
+	}
+
+	for _, testCase := range cases {
+		digest, err := parseDigest(testCase.value)
+		if (err != nil) != testCase.invalid {
+			t.Errorf("Failed %q: %v \n", testCase.value, err)
+
+			continue
+		}
+
+		var actual string
+		if digest != nil {
+			actual = digest.String()
+		}
+
+		if actual != testCase.expected {
+			t.Errorf("Failed %q: %q, expected %q \n", testCase.value, actual, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadServerDigest(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	sha := sha256.Sum256(content)
+	wrong := sha256.Sum256([]byte("something else"))
+	digest := base64.StdEncoding.EncodeToString(sha[:])
+	wrongDigest := base64.StdEncoding.EncodeToString(wrong[:])
+
+	cases := []struct {
+		name         string
+		header       string
+		value        string
+		acceptRanges bool
+		trailer      bool
+		checksum     string
+		noVerify     bool
+		mismatch     bool
+	}{
+		{"serial", digestHeader, "SHA-256=" + digest, false, false, "", false, false},
+		{"serial wrong", digestHeader, "SHA-256=" + wrongDigest, false, false, "", false, true},
+		{"parallel", contentDigestHeader, "sha-256=:" + digest + ":", true, false, "", false, false},
+		{"parallel wrong", contentDigestHeader, "sha-256=:" + wrongDigest + ":", true, false, "", false, true},
+		{"trailer", contentDigestHeader, "sha-256=:" + digest + ":", false, true, "", false, false},
+		{"trailer wrong", contentDigestHeader, "sha-256=:" + wrongDigest + ":", false, true, "", false, true},
+		{"unverified", digestHeader, "SHA-256=" + wrongDigest, true, false, "", true, false},
+		// A digest contradicting the expected checksum fails even though
+		// the checksum matches.
+		{"contradiction", digestHeader, "SHA-256=" + wrongDigest, true, false, "sha256:" + hex.EncodeToString(sha[:]), false, true},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.trailer {
+				w.Header().Set("Trailer", testCase.header)
+				_, _ = w.Write(content)
+				w.Header().Set(testCase.header, testCase.value)
+
+				return
+			}
+
+			w.Header().Set(testCase.header, testCase.value)
+
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 4,
+			Checksum:         testCase.checksum,
+			NoVerifyDigest:   testCase.noVerify,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if testCase.mismatch {
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("Failed %s: %v, expected a checksum mismatch \n", testCase.name, err)
+			}
+
+			if fileExists(filepath.Join(dir, "file.bin")) || fileExists(filepath.Join(dir, "file.bin"+partialFileSuffix)) {
+				t.Errorf("Failed %s: the mismatching file was kept \n", testCase.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if data, err := os.ReadFile(result.FileName); err != nil || !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: %d bytes, %v \n", testCase.name, len(data), err)
+		}
+
+		// The sum of the verified digest is reported; an unverified file
+		// isn't hashed at all.
+		expected := "sha256:" + hex.EncodeToString(sha[:])
+		if testCase.noVerify {
+			expected = ""
+		}
+
+		if result.Checksum != expected {
+			t.Errorf("Failed %s: checksum %q, expected %q \n", testCase.name, result.Checksum, expected)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package fastdownloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// ErrFileTooLarge is returned when a download exceeds Options.MaxSize.
+var ErrFileTooLarge = errors.New("file exceeds the maximum size")
+
+// ErrInsufficientSpace is returned when the file doesn't fit on the target
+// filesystem.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// checkSize makes sure a file of size bytes, of which needed are still to be
+// written, may be saved to fileName. It enforces Options.MaxSize and the free
+// space of the target filesystem unless Options.Force is set.
+func checkSize(fileName string, size, needed uint64, opts Options) error {
+	if opts.Force {
+		return nil
+	}
+
+	if err := checkMaxSize(size, opts); err != nil {
+		return err
+	}
+
+	free, ok := freeDiskSpace(filepath.Dir(fileName))
+	if ok && needed > free {
+		return fmt.Errorf("%w: %s needed, %s free in %s", ErrInsufficientSpace,
+			FormatBytes(float64(needed), "B"), FormatBytes(float64(free), "B"), filepath.Dir(fileName))
+	}
+
+	return nil
+}
+
+// checkMaxSize enforces Options.MaxSize on a download of size bytes unless
+// Options.Force is set. Downloads that aren't saved to disk, like streams and
+// Sinks, only get this part of checkSize.
+func checkMaxSize(size uint64, opts Options) error {
+	if opts.Force || opts.MaxSize == 0 || size <= opts.MaxSize {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s is larger than %s", ErrFileTooLarge,
+		FormatBytes(float64(size), "B"), FormatBytes(float64(opts.MaxSize), "B"))
+}
+
+// maxSizeReader fails with ErrFileTooLarge once more than max bytes were read,
+// for responses whose size isn't known up front.
+type maxSizeReader struct {
+	reader io.Reader
+	max    uint64
+	read   uint64
+}
+
+func (r *maxSizeReader) Read(data []byte) (int, error) {
+	n, err := r.reader.Read(data)
+	r.read += uint64(n)
+
+	if r.read > r.max {
+		return n, fmt.Errorf("%w: more than %s", ErrFileTooLarge, FormatBytes(float64(r.max), "B"))
+	}
+
+	return n, err
+}
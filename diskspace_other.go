@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package fastdownloader
+
+// freeDiskSpace can't tell the free space on this platform, so the check is
+// skipped.
+func freeDiskSpace(dir string) (uint64, bool) {
+	return 0, false
+}
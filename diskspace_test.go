@@ -0,0 +1,193 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckSize(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+
+	_, knownFreeSpace := freeDiskSpace(filepath.Dir(fileName))
+
+	cases := []struct {
+		size     uint64
+		needed   uint64
+		opts     Options
+		expected error
+	}{
+		{100, 100, Options{}, nil},
+		{100, 100, Options{MaxSize: 100}, nil},
+		{101, 1, Options{MaxSize: 100}, ErrFileTooLarge},
+		{101, 101, Options{MaxSize: 100, Force: true}, nil},
+		{math.MaxInt64, math.MaxInt64, Options{Force: true}, nil},
+		{math.MaxInt64, math.MaxInt64, Options{}, ErrInsufficientSpace},
+	}
+
+	for _, testCase := range cases {
+		// The free space can't be checked on every platform.
+		if errors.Is(testCase.expected, ErrInsufficientSpace) && !knownFreeSpace {
+			continue
+		}
+
+		err := checkSize(fileName, testCase.size, testCase.needed, testCase.opts)
+
+		if !errors.Is(err, testCase.expected) || (err != nil) != (testCase.expected != nil) {
+			t.Errorf("Failed %d/%d %+v: %v, expected %v \n", testCase.size, testCase.needed, testCase.opts, err, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadMaxSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	cases := []struct {
+		name         string
+		acceptRanges bool
+	}{
+		{"parallel", true},
+		{"streamed", false},
+	}
+
+	for _, testCase := range cases {
+		var getRequests int
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				if r.Header.Get("Range") != "" && r.Header.Get("Range") != "bytes=0-0" {
+					getRequests++
+				}
+
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			// Without a length the limit can only be enforced while reading.
+			for i := 0; i < len(content); i += 1000 {
+				_, _ = w.Write(content[i : i+1000])
+				w.(http.Flusher).Flush()
+			}
+		}))
+
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      dir,
+			HTTPClient:     server.Client(),
+			MaxSize:        uint64(len(content) - 1),
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if !errors.Is(err, ErrFileTooLarge) {
+			t.Errorf("Failed %s: %v, expected %v \n", testCase.name, err, ErrFileTooLarge)
+		}
+
+		if getRequests != 0 {
+			t.Errorf("Failed %s: %d chunks requested beyond the limit \n", testCase.name, getRequests)
+		}
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Failed %s: %d files left behind \n", testCase.name, len(entries))
+		}
+	}
+}
+
+func TestMaxSizeWithoutFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	// Each destination is given a known length through byte ranges and an
+	// unknown one through a streamed response.
+	destinations := []struct {
+		name     string
+		download func(url string, opts Options) error
+	}{
+		{"stream", func(url string, opts Options) error {
+			stream, _, err := OpenStream(context.Background(), url, opts)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(io.Discard, stream)
+
+			return errors.Join(err, stream.Close())
+		}},
+		{"stdout", func(url string, opts Options) error {
+			stdout := os.Stdout
+			defer func() { os.Stdout = stdout }()
+
+			devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+
+			defer func() { _ = devNull.Close() }()
+
+			os.Stdout = devNull
+			opts.OutputPath = StdoutOutputPath
+
+			_, err = Download(context.Background(), url, opts)
+
+			return err
+		}},
+		{"sink", func(url string, opts Options) error {
+			opts.Sink = &memorySink{}
+
+			_, err := Download(context.Background(), url, opts)
+
+			return err
+		}},
+	}
+
+	for _, destination := range destinations {
+		for _, acceptRanges := range []bool{true, false} {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if acceptRanges {
+					http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+					return
+				}
+
+				for i := 0; i < len(content); i += 1000 {
+					_, _ = w.Write(content[i : i+1000])
+					w.(http.Flusher).Flush()
+				}
+			}))
+
+			err := destination.download(server.URL+"/file.bin", Options{
+				TempDir:        t.TempDir(),
+				HTTPClient:     server.Client(),
+				MaxSize:        uint64(len(content) - 1),
+				ProgressOutput: io.Discard,
+			})
+
+			server.Close()
+
+			if !errors.Is(err, ErrFileTooLarge) {
+				t.Errorf("Failed %s with ranges %t: %v, expected %v \n", destination.name, acceptRanges, err, ErrFileTooLarge)
+			}
+		}
+	}
+}
+
+func TestMaxSizeReader(t *testing.T) {
+	for _, size := range []int{99, 100, 101} {
+		reader := &maxSizeReader{reader: bytes.NewReader(make([]byte, size)), max: 100}
+
+		_, err := io.Copy(io.Discard, reader)
+		if errors.Is(err, ErrFileTooLarge) != (size > 100) {
+			t.Errorf("Failed %d: %v \n", size, err)
+		}
+	}
+}
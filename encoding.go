@@ -0,0 +1,65 @@
+package fastdownloader
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+)
+
+// isEncoded reports whether a Content-Encoding value means the body differs
+// from the stored file, in which case Content-Length and byte ranges refer to
+// the encoded bytes.
+func isEncoded(encoding string) bool {
+	encoding = strings.TrimSpace(encoding)
+
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// decodeBody undoes a gzip or deflate Content-Encoding.
+func decodeBody(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// isGzipFile reports whether downloadURL is a gzip compressed file, as told by
+// a .gz path or a gzip Content-Type, as opposed to a gzip Content-Encoding of
+// the transfer.
+func isGzipFile(downloadURL string, header http.Header) bool {
+	if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if mediaType == "application/gzip" || mediaType == "application/x-gzip" {
+			return true
+		}
+	}
+
+	u, err := url.Parse(downloadURL)
+
+	return err == nil && strings.EqualFold(path.Ext(u.Path), ".gz")
+}
+
+// trimGzipExt removes the .gz extension from the name of a decompressed file.
+func trimGzipExt(fileName string) string {
+	base := filepath.Base(fileName)
+	if ext := filepath.Ext(base); strings.EqualFold(ext, ".gz") && len(base) > len(ext) {
+		return strings.TrimSuffix(fileName, ext)
+	}
+
+	return fileName
+}
@@ -0,0 +1,207 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadEncodedContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write(content)
+	_ = writer.Close()
+
+	cases := []struct {
+		decompress bool
+		expected   []byte
+	}{
+		{false, compressed.Bytes()},
+		{true, content},
+	}
+
+	for _, testCase := range cases {
+		var rangeRequests int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				atomic.AddInt32(&rangeRequests, 1)
+			}
+
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(compressed.Bytes())
+			}
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/file.txt", Options{
+			OutputDir:      t.TempDir(),
+			HTTPClient:     server.Client(),
+			Decompress:     testCase.decompress,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(result.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, testCase.expected) {
+			t.Errorf("Failed decompress %t: %d bytes saved, expected %d \n", testCase.decompress, len(data), len(testCase.expected))
+		}
+
+		if result.Bytes != uint64(compressed.Len()) {
+			t.Errorf("Failed decompress %t: %d bytes reported, expected %d \n", testCase.decompress, result.Bytes, compressed.Len())
+		}
+
+		if rangeRequests != 0 {
+			t.Errorf("Failed decompress %t: %d range requests for encoded content \n", testCase.decompress, rangeRequests)
+		}
+	}
+}
+
+func TestRequestAsksForStoredBytes(t *testing.T) {
+	cases := []struct {
+		header   http.Header
+		expected string
+	}{
+		{nil, "identity"},
+		{http.Header{"Accept-Encoding": {"gzip"}}, "gzip"},
+	}
+
+	for _, testCase := range cases {
+		req, err := newRequest(context.Background(), http.MethodGet, "http://example.com/", Options{Header: testCase.header})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if encoding := req.Header.Get("Accept-Encoding"); encoding != testCase.expected {
+			t.Errorf("Failed %q != %q \n", encoding, testCase.expected)
+		}
+	}
+}
+
+func TestIsGzipFile(t *testing.T) {
+	cases := []struct {
+		url         string
+		contentType string
+		expected    bool
+	}{
+		{"https://example.com/data.csv.gz", "", true},
+		{"https://example.com/DATA.GZ?x=1", "", true},
+		{"https://example.com/download?id=1", "application/gzip", true},
+		{"https://example.com/download?id=1", "application/x-gzip; charset=binary", true},
+		{"https://example.com/data.csv", "text/csv", false},
+		{"https://example.com/data.tgz", "", false},
+	}
+
+	for _, testCase := range cases {
+		header := http.Header{}
+		header.Set("Content-Type", testCase.contentType)
+
+		if isGzipFile(testCase.url, header) != testCase.expected {
+			t.Errorf("Failed %s %s: expected %t \n", testCase.url, testCase.contentType, testCase.expected)
+		}
+	}
+
+	for fileName, expected := range map[string]string{"dir/data.csv.gz": "dir/data.csv", "data.GZ": "data", ".gz": ".gz", "data.csv": "data.csv"} {
+		if trimmed := trimGzipExt(fileName); trimmed != expected {
+			t.Errorf("Failed %q: %q != %q \n", fileName, trimmed, expected)
+		}
+	}
+}
+
+func TestDownloadDecompressesGzipFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	var compressed bytes.Buffer
+
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write(content)
+	_ = writer.Close()
+
+	// The end of the stream, with its checksum, is cut off.
+	corrupt := compressed.Bytes()[:compressed.Len()-8]
+
+	cases := []struct {
+		body []byte
+		fail bool
+	}{
+		{compressed.Bytes(), false},
+		{corrupt, true},
+		{[]byte("not gzip at all"), true},
+	}
+
+	for _, testCase := range cases {
+		var rangeRequests int32
+
+		// The server supports ranges, but the file must still be fetched in
+		// order to be decompressed.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" && r.Header.Get("Range") != "bytes=0-0" {
+				atomic.AddInt32(&rangeRequests, 1)
+			}
+
+			http.ServeContent(w, r, "data.csv.gz", time.Time{}, bytes.NewReader(testCase.body))
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/data.csv.gz", Options{
+			OutputDir:      dir,
+			Decompress:     true,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if rangeRequests != 0 {
+			t.Errorf("Failed %d range requests for a decompressed file \n", rangeRequests)
+		}
+
+		if testCase.fail {
+			if err == nil {
+				t.Errorf("Failed corrupt gzip of %d bytes accepted \n", len(testCase.body))
+			}
+
+			if fileExists(filepath.Join(dir, "data.csv")) {
+				t.Errorf("Failed corrupt gzip saved \n")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.FileName != filepath.Join(dir, "data.csv") {
+			t.Errorf("Failed saved as %s, expected data.csv \n", result.FileName)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(content))
+		}
+	}
+}
@@ -1,358 +1,1895 @@
-package main
+// Package fastdownloader downloads files over HTTP, splitting the transfer
+// into parallel byte-range requests when the server supports it.
+package fastdownloader
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
-	"mime"
+	"math/rand"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 var ErrNoParallelDownload = errors.New("parallel download not supported")
 
+// NoParallelReason tells why a download can't be split into byte ranges.
+type NoParallelReason int
+
+const (
+	// ReasonNoAcceptRanges means the server doesn't support byte ranges.
+	ReasonNoAcceptRanges NoParallelReason = iota + 1
+
+	// ReasonNoContentLength means the size of the file is unknown.
+	ReasonNoContentLength
+
+	// ReasonContentEncoded means the response has a Content-Encoding, so
+	// ranges would address the encoded bytes.
+	ReasonContentEncoded
+
+	// ReasonRangeIgnored means a range request was answered with something
+	// other than 206 Partial Content.
+	ReasonRangeIgnored
+
+	// ReasonDecompressing means a gzip file is decompressed while it is
+	// downloaded, which needs its bytes in order.
+	ReasonDecompressing
+)
+
+func (r NoParallelReason) String() string {
+	switch r {
+	case ReasonNoAcceptRanges:
+		return "the server doesn't accept byte ranges"
+	case ReasonNoContentLength:
+		return "the content length is unknown"
+	case ReasonContentEncoded:
+		return "the response is content encoded"
+	case ReasonRangeIgnored:
+		return "the server ignored a range request"
+	case ReasonDecompressing:
+		return "the file is decompressed while downloading"
+	}
+
+	return "unknown reason"
+}
+
+// NoParallelError is the ErrNoParallelDownload of a particular download. It
+// matches ErrNoParallelDownload with errors.Is; use errors.As to get the
+// Reason.
+type NoParallelError struct {
+	Reason NoParallelReason
+
+	// Status is the response status of a ReasonRangeIgnored range request.
+	Status string
+}
+
+func (e *NoParallelError) Error() string {
+	if e.Reason == ReasonRangeIgnored && e.Status != "" {
+		return fmt.Sprintf("%s: range request answered with %s", ErrNoParallelDownload, e.Status)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrNoParallelDownload, e.Reason)
+}
+
+func (e *NoParallelError) Is(target error) bool {
+	return target == ErrNoParallelDownload
+}
+
+var errMissingContentLength = errors.New("missing content length")
+
+// ErrTooManyRedirects is returned when a request is redirected more often
+// than Options.MaxRedirects allows, e.g. by a redirect loop.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrFileExists is returned when the output file already exists and neither
+// Overwrite, NoClobber nor AutoRename is set.
+var ErrFileExists = errors.New("file already exists")
+
+// ErrLengthMismatch is returned when the completed file doesn't have the size
+// the server announced. The partial file is kept unless RemovePartial is set.
+var ErrLengthMismatch = errors.New("downloaded size doesn't match Content-Length")
+
+// ErrSizeMismatch is returned when the server's size of the file differs from
+// Options.ExpectedSize. The partial file is removed.
+var ErrSizeMismatch = errors.New("file size doesn't match the expected size")
+
+// errSkipExisting stops a NoClobber download whose output file exists.
+var errSkipExisting = errors.New("file exists, skipping")
+
+// errUpToDate stops a download whose output file is already up to date.
+var errUpToDate = errors.New("file is up to date, skipping")
+
+// errRemoteFileChanged means the server answered a range request guarded by
+// If-Range with the whole file, or found the range past the end of the file,
+// because it changed since the download began.
+var errRemoteFileChanged = errors.New("remote file changed")
+
+// DefaultProgressOutput receives progress when Options.ProgressOutput is nil.
+// Progress goes to stderr so stdout stays usable for piping.
+var DefaultProgressOutput io.Writer = os.Stderr
+
+// DefaultParallelRequests is used when Options.ParallelRequests is zero.
+const DefaultParallelRequests uint64 = 5
+
+// DefaultMaxRedirects is used when Options.MaxRedirects is zero. It matches
+// the limit of http.Client's default policy.
+const DefaultMaxRedirects = 10
+
+// DefaultBufferSize is used when Options.BufferSize is zero. It matches the
+// buffer io.Copy allocates.
+const DefaultBufferSize uint64 = 32 * 1024
+
+// Options configures a download.
+type Options struct {
+	// ParallelRequests is the number of byte ranges downloaded concurrently.
+	ParallelRequests uint64
+
+	// Chunks is the number of byte ranges the file is split into. They are
+	// downloaded by a pool of ParallelRequests workers, so many small chunks
+	// don't mean many simultaneous connections. It defaults to
+	// ParallelRequests when zero, or four times that with Adaptive.
+	Chunks uint64
+
+	// Adaptive treats ParallelRequests as a maximum and adjusts the number of
+	// simultaneous range requests to the network. It starts with one and
+	// adds connections every second while they raise the throughput, and
+	// takes them back when they don't or when round trip times climb. The
+	// limit can change between chunks, so the file should be split into many
+	// of them.
+	Adaptive bool
+
+	// ChunkStrategy decides how the file is split into byte ranges. It
+	// defaults to EqualChunks of Chunks ranges.
+	ChunkStrategy ChunkStrategy
+
+	// Mirrors are further URLs serving the same file. A parallel download
+	// fetches chunks from the download URL and the mirrors supporting byte
+	// ranges at the same time, giving slow mirrors fewer chunks and moving a
+	// failed chunk on to another one. A mirror announcing a different size
+	// fails the download with ErrMirrorMismatch.
+	Mirrors []string
+
+	// OutputPath overrides the file name chosen by the FilenameResolver. A
+	// relative path is resolved against OutputDir. StdoutOutputPath ("-")
+	// writes the file to stdout instead; a parallel download is then
+	// reordered through a temporary spool file.
+	OutputPath string
+
+	// Overwrite replaces an existing output file. Downloads fail with
+	// ErrFileExists instead unless NoClobber or AutoRename is set.
+	Overwrite bool
+
+	// NoClobber skips the download when the output file already exists and
+	// reports it with Result.Skipped.
+	NoClobber bool
+
+	// Newer only downloads a file again when the server's Last-Modified is
+	// later than the modification time of the existing output file, which
+	// it then replaces. Otherwise the download is skipped and reported with
+	// Result.UpToDate. A response without Last-Modified is always
+	// downloaded. It doesn't apply to ftp URLs.
+	Newer bool
+
+	// AutoRename saves the download as "name (1).ext", "name (2).ext" and so
+	// on when the output file already exists.
+	AutoRename bool
+
+	// Sink receives the download instead of a local file, e.g. an in-memory
+	// buffer or a multipart upload. A parallel download writes every chunk at
+	// its offset as it arrives, a single request writes from offset zero on.
+	// Sinks with a Truncate(int64) error method, like *os.File, are sized to
+	// the file first. Checksum needs a Sink that also implements io.ReaderAt
+	// to read the download back. Sinks can't receive ftp downloads or be
+	// combined with StdoutOutputPath, and Result.FileName is empty.
+	Sink io.WriterAt
+
+	// Assembler receives the download instead of a local file like Sink, for
+	// destinations that take the byte ranges as streams rather than at
+	// offsets. It is finalized after the last range was written. Checksum
+	// needs an Assembler that also implements io.ReaderAt. Assembler and Sink
+	// are exclusive.
+	Assembler Assembler
+
+	// Sparse doesn't write the zero-filled regions of parallel downloads, so
+	// they take no disk space on filesystems with sparse files, like for
+	// disk images. It is ignored with a ChunkVerifier, whose corrupt chunks
+	// have to be overwritten completely.
+	Sparse bool
+
+	// ByteRange downloads only these bytes of the file, saved as a file of
+	// their own. The server must support byte ranges and the range must lie
+	// within the file. It doesn't apply to ftp URLs, Sinks or
+	// StdoutOutputPath, and a failed range download isn't resumed.
+	ByteRange *Range
+
+	// FilenameResolver picks the file name when OutputPath is empty. It
+	// defaults to DefaultFilenameResolver. It doesn't apply to ftp URLs,
+	// which are named after their path.
+	FilenameResolver FilenameResolver
+
+	// OutputTemplate renames downloads whose name isn't given by OutputPath,
+	// e.g. "{index}-{name}" for "001-file.zip". Its placeholders are {name},
+	// the resolved file name, {ext}, its extension with the dot, {host}, the
+	// host name of the URL, {index}, OutputIndex padded to three digits, and
+	// {date}, the day the download started as 2006-01-02. See
+	// ValidateOutputTemplate.
+	OutputTemplate string
+
+	// OutputIndex is the position of the download in a batch, for the
+	// {index} of OutputTemplate.
+	OutputIndex int
+
+	// DefaultFileName names downloads of URLs without a file name, like a
+	// site's root, when the default FilenameResolver can't find one in the
+	// headers either. It may contain "{host}" and "{time}"; see
+	// DefaultFilenameResolver. It defaults to "index.html".
+	DefaultFileName string
+
+	// TempDir is the directory partial files, their resume state and the
+	// spool of a parallel download to stdout are written to, e.g. a fast
+	// local disk when OutputDir is a network mount. Completed files are
+	// moved to OutputDir, copied when it is on another filesystem. Partial
+	// files go next to the output file when empty, the spool to the
+	// system's temporary directory.
+	TempDir string
+
+	// OutputDir is the directory the file is saved into. It must already
+	// exist; the current working directory is used when empty.
+	OutputDir string
+
+	// PreservePath saves the download under the directories of its URL path
+	// below OutputDir, e.g. OutputDir/a/b/file.bin for
+	// https://example.com/a/b/file.bin, creating them as needed. Without it
+	// only the file name is kept. It has no effect with OutputPath.
+	PreservePath bool
+
+	// HTTPClient is used for every request, e.g. to share a connection pool
+	// between downloads or to inject a test transport. When nil, each
+	// download builds a client from the Proxy, TLSConfig and ConnectTimeout
+	// options whose pool keeps ParallelRequests connections alive.
+	HTTPClient *http.Client
+
+	// Method is the method of the download requests, e.g. POST for an
+	// endpoint that takes a query describing the file. It defaults to GET, or
+	// to POST when Body is set. A method other than GET skips the HEAD probe:
+	// the range probe and every chunk replay the method and Body with a Range
+	// header, and servers that ignore ranges on such requests are downloaded
+	// serially.
+	Method string
+
+	// Body is sent with every download request.
+	Body []byte
+
+	// Header is added to every request. Range is managed by the downloader,
+	// so a user supplied Range header is ignored.
+	Header http.Header
+
+	// Cookies are sent with every request they match. Cookies without a
+	// Domain belong to the host of the download URL. Each download keeps its
+	// cookies in a jar of its own, so a session cookie set by a redirect
+	// reaches all chunk requests. When HTTPClient has a Jar, the cookies are
+	// added to it instead.
+	Cookies []*http.Cookie
+
+	// Username and Password are sent with HTTP Basic authentication.
+	Username string
+	Password string
+
+	// BearerToken is sent as "Authorization: Bearer <token>". It takes
+	// precedence over Username and Password.
+	BearerToken string
+
+	// Netrc supplies HTTP Basic and ftp credentials by host, e.g. from
+	// ~/.netrc read by ParseNetrc, when none of the above, an Authorization
+	// header or credentials in the URL are given. Its default entry only
+	// applies to the host of the download URL.
+	Netrc *Netrc
+
+	// AuthOnRedirect keeps sending credentials after a redirect to another
+	// host. They are only sent to the host of the download URL otherwise.
+	AuthOnRedirect bool
+
+	// MaxRedirects is the most redirects a request follows, or
+	// DefaultMaxRedirects when zero unless HTTPClient has a CheckRedirect
+	// policy of its own. A negative value follows none. Exceeding it fails
+	// with ErrTooManyRedirects.
+	MaxRedirects int
+
+	// Retries is the number of times a failed range request is retried.
+	Retries int
+
+	// RetryBaseDelay is the delay before the first retry, doubled for every
+	// following one. DefaultRetryBaseDelay is used when zero.
+	RetryBaseDelay time.Duration
+
+	// Checksum is the expected "algorithm:hex" digest of the downloaded file,
+	// e.g. "sha256:9f86d0...". Supported algorithms are sha256, sha1 and md5.
+	Checksum string
+
+	// ChecksumList looks up the checksum of the downloaded file by the name it
+	// is saved as when Checksum is empty, e.g. from a SHA256SUMS file read by
+	// ParseChecksumList. A file that isn't listed fails the download. It
+	// doesn't apply to Sinks or StdoutOutputPath.
+	ChecksumList ChecksumList
+
+	// ChunkVerifier checks every chunk of a parallel download as soon as it
+	// is complete, e.g. with BlockChecksums. A corrupt chunk is fetched again
+	// like a failed one, from another mirror when there is one. It doesn't
+	// apply to OpenStream, which hands bytes out as they arrive.
+	ChunkVerifier ChunkVerifier
+
+	// VerifyRetries is how often a parallel download of the wrong length, or
+	// that doesn't match its Checksum or the server's digest, is repaired
+	// instead of failed: the chunks missing from a short file, and those the
+	// ChunkVerifier finds corrupt in the assembled file, are fetched again
+	// before the file is verified once more. Without a ChunkVerifier only the
+	// length can be repaired.
+	VerifyRetries int
+
+	// RateLimit caps the aggregate download speed across all connections in
+	// bytes per second. Zero means unlimited.
+	RateLimit uint64
+
+	// MaxConnsPerHost caps the connections to a single host, including those
+	// still being dialed, so ParallelRequests beyond it wait for a free one.
+	// Zero means no limit. It only applies when HTTPClient is nil.
+	MaxConnsPerHost int
+
+	// IPVersion restricts connections to IPv4 when 4 or IPv6 when 6, for
+	// dual-stack hosts with one broken path. Zero uses either. It applies
+	// to ftp URLs, and to http URLs when HTTPClient is nil.
+	IPVersion int
+
+	// BindAddress is the local IP address connections are made from, to pick
+	// the network interface of a multi-homed machine. It applies to ftp
+	// URLs, and to http URLs when HTTPClient is nil.
+	BindAddress string
+
+	// HTTP1 keeps HTTPS downloads on HTTP/1.1. Over HTTP/2 the
+	// ParallelRequests share a single multiplexed connection, which some
+	// servers throttle as one client; HTTP/1.1 opens a connection per
+	// request instead. It only applies when HTTPClient is nil.
+	HTTP1 bool
+
+	// RampUp spreads the first requests of a parallel download randomly over
+	// this duration instead of sending them all at once, which some servers
+	// punish with rate limiting.
+	RampUp time.Duration
+
+	// ConnectTimeout limits how long establishing a connection may take. It
+	// only applies when HTTPClient is nil. Use a context deadline to limit
+	// the download as a whole.
+	ConnectTimeout time.Duration
+
+	// ResponseHeaderTimeout limits how long the server may take to answer a
+	// request once it was sent, so a stalled chunk request fails and is
+	// retried instead of hanging. DefaultResponseHeaderTimeout is used when
+	// zero. It only applies when HTTPClient is nil.
+	ResponseHeaderTimeout time.Duration
+
+	// IdleConnTimeout is how long a kept-alive connection may sit unused
+	// before it is closed, e.g. between the chunks of a rate-limited or
+	// ramping-up download. The net/http default of 90 seconds is used when
+	// zero. It only applies when HTTPClient is nil.
+	IdleConnTimeout time.Duration
+
+	// Proxy routes all requests through an http://, https:// or socks5://
+	// proxy, optionally with user:pass@ credentials. It only applies when
+	// HTTPClient is nil; the environment's HTTP_PROXY settings are used
+	// otherwise.
+	Proxy string
+
+	// TLSConfig customizes TLS, e.g. with a private CA pool or a client
+	// certificate for mutual TLS. It only applies when HTTPClient is nil.
+	TLSConfig *tls.Config
+
+	// NoPreserveTime leaves the modification time of the saved file at the
+	// time of the download instead of setting it to the server's
+	// Last-Modified.
+	NoPreserveTime bool
+
+	// WriteManifest saves a Manifest next to every completed download as
+	// "<name>.json". An HTTP download whose output file has a manifest
+	// matching the remote file's ETag or Last-Modified and size is skipped
+	// and reported with Result.Skipped, unless Overwrite is set. A sha256
+	// Checksum is then compared with the manifest instead of the file.
+	WriteManifest bool
+
+	// ExpectedSize is the known size of the file. It skips probing the URL,
+	// and its mirrors, with HEAD or a range request and splits the file
+	// straight away, for endpoints that reject or mishandle HEAD. Every range
+	// response must then be 206 Partial Content with a Content-Range total
+	// matching ExpectedSize; a different total fails the download with
+	// ErrSizeMismatch. Without a Content-Disposition from a probe, the file
+	// is named after the URL.
+	ExpectedSize uint64
+
+	// MaxSize aborts downloads larger than this many bytes before anything is
+	// written, or as soon as a response of unknown length exceeds it. Zero
+	// means unlimited.
+	MaxSize uint64
+
+	// ExpectType fails downloads whose Content-Type isn't this media type
+	// before anything is written, e.g. an HTML login page served instead of
+	// "application/zip". Several types are separated by commas, and "image/*"
+	// matches every image type. It doesn't apply to ftp URLs.
+	ExpectType string
+
+	// Force skips the MaxSize and free disk space checks.
+	Force bool
+
+	// Continue resumes the partial file of an interrupted serial download
+	// when the server supports byte ranges, instead of starting over.
+	// Parallel downloads always resume. It is ignored with Decompress.
+	Continue bool
+
+	// RemovePartial deletes the partial file of a failed download instead of
+	// keeping it for a later resume. Without it, the partial file is only
+	// kept when the download was interrupted or failed on a transient error,
+	// like a network error or a 5xx status, and removed when it failed
+	// permanently, e.g. with a 404 status.
+	RemovePartial bool
+
+	// KeepPartial keeps the partial file of a permanently failed download
+	// too, e.g. to inspect it.
+	KeepPartial bool
+
+	// NoVerifyLength skips comparing the size of a completed download with
+	// the length the server announced before the file gets its final name.
+	NoVerifyLength bool
+
+	// NoVerifyDigest skips checking a completed download against the digest
+	// the server announced in a Content-Digest or Digest header or trailer.
+	// The digest is verified like Checksum otherwise, and a digest that
+	// contradicts Checksum fails the download.
+	NoVerifyDigest bool
+
+	// NoFallback fails downloads that can't be split into byte ranges with
+	// ErrNoParallelDownload instead of falling back to a single request. It
+	// doesn't apply to ftp URLs.
+	NoFallback bool
+
+	// Decompress decodes a gzip or deflate Content-Encoding before saving.
+	// Encoded responses are saved as sent otherwise, which is what their
+	// Content-Length and a checksum published next to them refer to. Either
+	// way an encoded response is downloaded with a single request, since byte
+	// ranges would address the encoded bytes. Decompress also decompresses
+	// gzip files, recognized by a .gz URL path or a gzip Content-Type, with a
+	// single request and saves them without the .gz extension. It doesn't
+	// apply to Sinks, byte ranges or StdoutOutputPath.
+	Decompress bool
+
+	// BufferSize is the size of the buffer each connection copies the
+	// response body through. Larger buffers mean fewer system calls on fast
+	// links. DefaultBufferSize is used when zero.
+	BufferSize uint64
+
+	// ProgressOutput receives the progress line and status messages. It
+	// defaults to DefaultProgressOutput; use io.Discard to silence them.
+	ProgressOutput io.Writer
+
+	// ProgressFunc is called with the bytes downloaded so far and the total,
+	// or zero when the total is unknown. Calls are throttled to one per
+	// ProgressInterval plus a final one, and never overlap. A ProgressBar on
+	// ProgressOutput is used when nil.
+	ProgressFunc func(downloaded, total uint64)
+
+	// ProgressInterval is the minimum time between two progress reports; the
+	// bytes written in between are reported together. The package's
+	// ProgressInterval is used when zero.
+	ProgressInterval time.Duration
+
+	// Controller pauses and resumes the download while it runs.
+	Controller *Controller
+
+	// ProgressServer serves the progress of the download, and the status of
+	// its chunks, over HTTP while it runs.
+	ProgressServer *ProgressServer
+
+	// Logger receives diagnostics such as every range request, its response
+	// status and timing, and retry attempts. Nothing is logged when nil.
+	Logger *slog.Logger
+
+	// Trace logs how long the DNS lookup, connect, TLS handshake and time to
+	// first byte of every request took at debug level, and summarizes the
+	// time to first byte of the download in Result.Trace.
+	Trace bool
+
+	limiter  *rateLimiter
+	checksum *checksum
+	authHost string
+
+	// digest is the server's digest of the file being finished, and verified
+	// is set once it and the checksum were checked.
+	digest   *checksum
+	verified bool
+
+	// adaptive limits the range requests of an Adaptive download.
+	adaptive *adaptiveLimit
+
+	// traces collects the timings of a Trace download.
+	traces *traceStats
+}
+
+// prepare fills in defaults and creates the per-download state shared by all
+// requests for downloadURL.
+func (o Options) prepare(downloadURL string) (Options, error) {
+	if err := checkScheme(downloadURL); err != nil {
+		return o, err
+	}
+
+	if o.Method == "" && o.Body != nil {
+		o.Method = http.MethodPost
+	}
+
+	if o.ParallelRequests == 0 {
+		o.ParallelRequests = DefaultParallelRequests
+	}
+
+	if o.Chunks == 0 {
+		o.Chunks = o.ParallelRequests
+
+		if o.Adaptive {
+			o.Chunks *= 4
+		}
+	}
+
+	if o.HTTPClient == nil {
+		client, err := newHTTPClient(o)
+		if err != nil {
+			return o, err
+		}
+
+		o.HTTPClient = client
+	}
+
+	o.authHost = urlHost(downloadURL)
+
+	// The client is copied so the redirect policy and a new cookie jar don't
+	// leak into the caller's client.
+	client := *o.HTTPClient
+	client.CheckRedirect = redirectPolicy(client.CheckRedirect, o)
+
+	jar, err := cookieJar(client.Jar, downloadURL, o.Cookies)
+	if err != nil {
+		return o, err
+	}
+
+	client.Jar = jar
+	o.HTTPClient = &client
+
+	if o.RateLimit > 0 {
+		o.limiter = newRateLimiter(o.RateLimit)
+	}
+
+	if o.Trace {
+		o.traces = &traceStats{}
+	}
+
+	if o.OutputTemplate != "" {
+		if err := ValidateOutputTemplate(o.OutputTemplate); err != nil {
+			return o, err
+		}
+	}
+
+	if o.ExpectType != "" {
+		if _, err := parseExpectedTypes(o.ExpectType); err != nil {
+			return o, err
+		}
+	}
+
+	if o.Checksum != "" {
+		checksum, err := parseChecksum(o.Checksum)
+		if err != nil {
+			return o, err
+		}
+
+		o.checksum = checksum
+	}
+
+	return o, nil
+}
+
+// customMethod reports whether the download requests use a method other than
+// GET.
+func (o Options) customMethod() bool {
+	return o.Method != "" && o.Method != http.MethodGet
+}
+
+func (o Options) progressInterval() time.Duration {
+	if o.ProgressInterval > 0 {
+		return o.ProgressInterval
+	}
+
+	return ProgressInterval
+}
+
+func (o Options) progressOutput() io.Writer {
+	if o.ProgressOutput != nil {
+		return o.ProgressOutput
+	}
+
+	return DefaultProgressOutput
+}
+
+func (o Options) chunkStrategy() ChunkStrategy {
+	if o.ChunkStrategy != nil {
+		return o.ChunkStrategy
+	}
+
+	return EqualChunks{Count: o.Chunks}
+}
+
+func (o Options) progressFunc() func(downloaded, total uint64) {
+	if o.ProgressFunc != nil {
+		return o.ProgressFunc
+	}
+
+	return ProgressBar(o.progressOutput())
+}
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+
+	return discardLogger
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func (o Options) copyBufferSize() uint64 {
+	if o.BufferSize != 0 {
+		return o.BufferSize
+	}
+
+	return DefaultBufferSize
+}
+
+// fileAssembler writes the ranges of a download into dst, skipping zeros
+// when sparse.
+func (o Options) fileAssembler(dst io.WriterAt, sparse bool) *WriterAtAssembler {
+	return &WriterAtAssembler{Dst: dst, Sparse: sparse, BufferSize: o.copyBufferSize()}
+}
+
+// sinkAssembler returns what receives the download instead of a local file,
+// if anything.
+func (o Options) sinkAssembler() Assembler {
+	switch {
+	case o.Assembler != nil:
+		return o.Assembler
+	case o.Sink != nil:
+		return o.fileAssembler(o.Sink, false)
+	}
+
+	return nil
+}
+
+func (o Options) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+// Download fetches downloadURL into a local file, or Options.Sink, and
+// reports its name, the number of bytes transferred and the time it took. For
+// http and https URLs it tries a parallel download first and falls back to a
+// single request when the server doesn't support byte ranges. ftp URLs are
+// retrieved with a single transfer.
+func Download(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	startTime := time.Now()
+
+	opts, err := opts.prepare(downloadURL)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := checkSink(downloadURL, opts); err != nil {
+		return Result{}, err
+	}
+
+	if err := checkByteRange(downloadURL, opts); err != nil {
+		return Result{}, err
+	}
+
+	if opts.OutputPath == StdoutOutputPath {
+		written, err := downloadToStdout(ctx, downloadURL, opts)
+		if err != nil {
+			return Result{}, err
+		}
+
+		result := Result{
+			FileName: StdoutOutputPath,
+			Bytes:    written,
+			Duration: time.Since(startTime),
+			Trace:    opts.traces.summary(),
+		}
+		if opts.checksum != nil {
+			result.Checksum = opts.checksum.String()
+		}
+
+		return result, nil
+	}
+
+	var result Result
+
+	if isFTPURL(downloadURL) {
+		result, err = ftpDownload(ctx, downloadURL, opts)
+	} else {
+		result, err = httpDownload(ctx, downloadURL, opts)
+	}
+
+	if errors.Is(err, errSkipExisting) {
+		return Result{FileName: result.FileName, Skipped: true, Duration: time.Since(startTime)}, nil
+	}
+
+	if errors.Is(err, errUpToDate) {
+		return Result{FileName: result.FileName, Skipped: true, UpToDate: true, Duration: time.Since(startTime)}, nil
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	result.Duration = time.Since(startTime)
+	result.Trace = opts.traces.summary()
+
+	// A checksum that was verified holds for every kind of destination.
+	if opts.checksum != nil {
+		result.Checksum = opts.checksum.String()
+	}
+
+	return result, nil
+}
+
+// httpDownload downloads opts.ByteRange or the whole file, in parallel when
+// possible and serially otherwise.
+func httpDownload(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	if opts.ByteRange != nil {
+		return rangeDownload(ctx, downloadURL, opts)
+	}
+
+	result, err := parallelDownload(ctx, downloadURL, opts)
+	if errors.Is(err, errRemoteFileChanged) {
+		opts.logger().Info("remote file changed, restarting download", "url", downloadURL)
+		fmt.Fprintln(opts.progressOutput(), "Remote file changed, restarting download")
+
+		result, err = parallelDownload(ctx, downloadURL, opts)
+	}
+
+	if errors.Is(err, ErrNoParallelDownload) && !opts.NoFallback {
+		opts.logger().Info("falling back to serial download", "url", downloadURL, "reason", err)
+		if opts.customMethod() {
+			fmt.Fprintf(opts.progressOutput(), "Range requests with %s not supported, falling back to normal download\n", opts.Method)
+		} else {
+			fmt.Fprintln(opts.progressOutput(), "Parallel download not supported, falling back to normal download")
+		}
+
+		result, err = serialDownload(ctx, downloadURL, opts)
+	}
+
+	return result, err
+}
+
 const (
 	contentLengthHeader      = "Content-Length"
 	contentDispositionHeader = "Content-Disposition"
+	rangeHeader              = "Range"
+	ifRangeHeader            = "If-Range"
+	lastModifiedHeader       = "Last-Modified"
 )
 
+// newRequest builds a request carrying the headers and credentials of opts.
+// GET stands for the download request, which uses Options.Method and Body.
+// Unless the user asks for an encoding, the file is requested as stored; this
+// also stops the transport from transparently decompressing gzip responses.
+func newRequest(ctx context.Context, method, url string, opts Options) (*http.Request, error) {
+	var body io.Reader
+
+	if method == http.MethodGet && opts.Method != "" {
+		method = opts.Method
+
+		if opts.Body != nil {
+			body = bytes.NewReader(opts.Body)
+		}
+	}
+
+	if opts.traces != nil {
+		ctx = withTrace(ctx, method, url, opts)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(acceptEncodingHeader, "identity")
+
+	for key, values := range opts.Header {
+		if http.CanonicalHeaderKey(key) == rangeHeader {
+			continue
+		}
+
+		req.Header[key] = append([]string(nil), values...)
+	}
+
+	setAuthorization(req, opts)
+
+	return req, nil
+}
+
+// downloadRangeBytes fetches the part of c that isn't written yet from m and
+// hands it to asm.
 func downloadRangeBytes(
 	ctx context.Context,
-	fileName string,
+	opts Options,
+	asm Assembler,
 	progress io.Writer,
-	start, stop uint64,
-	url string,
+	c *chunk,
+	m mirror,
 ) error {
-	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	r, err := newRequest(ctx, http.MethodGet, m.url, opts)
 	if err != nil {
 		return err
 	}
 
-	r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, stop))
+	r.Header.Set(rangeHeader, fmt.Sprintf("bytes=%d-%d", c.Start+c.Written, c.Stop))
+
+	if m.validator != "" {
+		r.Header.Set(ifRangeHeader, m.validator)
+	}
+
+	log := opts.logger().With("start", c.Start+c.Written, "stop", c.Stop)
+	log.Debug("range request started")
+
+	started := time.Now()
+
+	res, err := opts.httpClient().Do(r)
+	if err != nil {
+		log.Debug("range request failed", "error", err, "elapsed", time.Since(started))
+		return err
+	}
+
+	defer func() { _ = res.Body.Close() }()
+
+	log.Debug("range response", "status", res.StatusCode)
+
+	if opts.adaptive != nil {
+		opts.adaptive.observeRTT(time.Since(started))
+	}
+
+	// Only a file smaller than the size hint has no bytes at the start of a
+	// chunk.
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable && opts.ExpectedSize > 0 {
+		return fmt.Errorf("%w: %d bytes expected, range %d-%d not satisfiable",
+			ErrSizeMismatch, opts.ExpectedSize, c.Start+c.Written, c.Stop)
+	}
+
+	// The chunk lies within the probed size, so the file shrank since.
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return fmt.Errorf("%w: range %d-%d not satisfiable, Content-Range %q",
+			errRemoteFileChanged, c.Start+c.Written, c.Stop, res.Header.Get(contentRangeHeader))
+	}
+
+	if err := checkStatus(res); err != nil {
+		return err
+	}
+
+	// Without a probe, e.g. with a size hint, the range responses are the
+	// first to tell the type.
+	if err := checkContentType(res.Header, opts); err != nil {
+		return err
+	}
+
+	// A server that ignores the range sends the whole file, which would end
+	// up at this chunk's offset and corrupt the download.
+	if res.StatusCode != http.StatusPartialContent && m.validator != "" {
+		return errRemoteFileChanged
+	}
+
+	if res.StatusCode != http.StatusPartialContent {
+		return &NoParallelError{Reason: ReasonRangeIgnored, Status: res.Status}
+	}
+
+	start, _, total, err := parseContentRange(res.Header.Get(contentRangeHeader))
+	if err == nil && start != c.Start+c.Written {
+		return fmt.Errorf("range request for offset %d answered from offset %d", c.Start+c.Written, start)
+	}
+
+	if opts.ExpectedSize > 0 && (err != nil || total != opts.ExpectedSize) {
+		return fmt.Errorf("%w: %d bytes expected, Content-Range %q", ErrSizeMismatch, opts.ExpectedSize, res.Header.Get(contentRangeHeader))
+	}
+
+	body := io.LimitReader(opts.limitRangeReader(ctx, res.Body, true), int64(c.remaining()))
+
+	if opts.adaptive != nil {
+		progress = io.MultiWriter(progress, opts.adaptive)
+	}
+
+	if err := writeChunk(asm, c, body, progress); err != nil {
+		return err
+	}
+
+	if c.remaining() > 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	log.Debug("range request finished", "elapsed", time.Since(started))
+
+	return nil
+}
+
+// outputFilePath combines the detected file name with the output options and
+// makes sure the target directory exists.
+func outputFilePath(fileName string, opts Options) (string, error) {
+	if opts.OutputPath != "" {
+		fileName = opts.OutputPath
+	}
+
+	if !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(opts.OutputDir, fileName)
+	}
+
+	dir := filepath.Dir(fileName)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("output directory %q is not accessible: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("output directory %q is not a directory", dir)
+	}
+
+	return fileName, nil
+}
+
+// targetFileName decides what to do when fileName already exists: it is
+// replaced with Overwrite or Newer, skipped with NoClobber and numbered with
+// AutoRename. It returns ErrFileExists otherwise. The directories PreservePath
+// added to fileName are created here, since Plan mustn't write them.
+func targetFileName(fileName string, opts Options) (string, error) {
+	if opts.PreservePath && opts.OutputPath == "" {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Overwrite || opts.Newer || !fileExists(fileName) {
+		return fileName, nil
+	}
+
+	if opts.NoClobber {
+		return fileName, errSkipExisting
+	}
+
+	if !opts.AutoRename {
+		return "", fmt.Errorf("%w: %s", ErrFileExists, fileName)
+	}
+
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+
+	for i := 1; ; i++ {
+		renamed := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !fileExists(renamed) {
+			return renamed, nil
+		}
+	}
+}
+
+func fileExists(fileName string) bool {
+	_, err := os.Lstat(fileName)
+
+	return err == nil
+}
+
+// headerLength returns the length a response announces. A missing or
+// malformed Content-Length leaves the length unknown instead of failing the
+// download.
+func headerLength(header http.Header, opts Options) (fileLength uint64, knownLength bool) {
+	fileLength, err := headerContentLength(header)
+	if err != nil && header.Get(contentLengthHeader) != "" {
+		opts.logger().Info("ignoring Content-Length", "value", header.Get(contentLengthHeader), "error", err)
+	}
+
+	return fileLength, err == nil
+}
+
+// headerContentLength returns errMissingContentLength when the response
+// doesn't announce a usable length.
+func headerContentLength(header http.Header) (uint64, error) {
+	contentLength := header.Get(contentLengthHeader)
+	if contentLength == "" {
+		return 0, errMissingContentLength
+	}
+
+	// An unusable length is treated like a missing one, so the download
+	// falls back to a single request instead of failing. Lengths beyond
+	// math.MaxInt64 can't be used as file offsets.
+	fileLength, err := strconv.ParseUint(contentLength, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid value %q", errMissingContentLength, contentLength)
+	}
+
+	return fileLength, nil
+}
+
+// headRequest probes url with a HEAD request, following redirects. The
+// returned response has its body closed; res.Request.URL is the final
+// resolved URL.
+func headRequest(ctx context.Context, opts Options, url string) (*http.Response, error) {
+	req, err := newRequest(ctx, http.MethodHead, url, opts)
+	if err != nil {
+		return nil, fmt.Errorf("http.head request creation failed %w", err)
+	}
+
+	res, err := opts.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http.head request failed %w", err)
+	}
+
+	_ = res.Body.Close()
+
+	opts.logger().Debug("head response", "url", res.Request.URL.String(), "status", res.StatusCode)
+
+	if err := checkStatus(res); err != nil {
+		return nil, fmt.Errorf("http.head request failed %w", err)
+	}
+
+	return res, nil
+}
+
+// UnitScale selects the multiples byte counts are displayed in.
+type UnitScale int
+
+const (
+	// IEC displays binary multiples of 1024: KiB, MiB, GiB and so on.
+	IEC UnitScale = iota
+
+	// SI displays decimal multiples of 1000: KB, MB, GB and so on.
+	SI
+)
+
+// Units is the scale of the sizes and speeds in progress lines, summaries and
+// download plans. It defaults to IEC.
+var Units = IEC
+
+// FormatBytes formats num with one decimal in the largest multiple of Units
+// below it, followed by suffix, e.g. "1.5 MiB" for 1572864 and "B". Negative
+// numbers keep their sign: -2048 formats as "-2.0 KiB".
+func FormatBytes(num float64, suffix string) string {
+	return formatBytesScale(num, suffix, Units)
+}
+
+func formatBytesScale(num float64, suffix string, scale UnitScale) string {
+	byteSize, units := 1024.0, []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"}
+	if scale == SI {
+		byteSize, units = 1000.0, []string{"", "K", "M", "G", "T", "P", "E", "Z", "Y"}
+	}
+
+	for _, unit := range units[:len(units)-1] {
+		if math.Abs(num) < byteSize {
+			return fmt.Sprintf("%3.1f %s%s", num, unit, suffix)
+		}
+
+		num /= byteSize
+	}
+
+	return fmt.Sprintf("%3.1f %s%s", num, units[len(units)-1], suffix)
+}
+
+// batchGenerator splits contentLength bytes into at most totalBatches
+// inclusive [start, stop] ranges of nearly equal size. The returned function
+// yields one range per call and false once all of them were handed out.
+func batchGenerator(contentLength, totalBatches uint64) func() (uint64, uint64, bool) {
+	if totalBatches == 0 {
+		totalBatches = 1
+	}
+
+	if totalBatches > contentLength {
+		totalBatches = contentLength
+	}
+
+	var (
+		m     sync.Mutex
+		start = uint64(0)
+		batch = uint64(0)
+	)
+
+	return func() (uint64, uint64, bool) {
+		m.Lock()
+		defer m.Unlock()
+
+		if batch >= totalBatches {
+			return uint64(0), uint64(0), false
+		}
+
+		// The remainder is spread over the first batches, one byte each.
+		batchSize := contentLength / totalBatches
+		if batch < contentLength%totalBatches {
+			batchSize++
+		}
+
+		batch++
+		start += batchSize
+
+		return start - batchSize, start - 1, true
+	}
+}
+
+func serialDownload(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	req, err := newRequest(ctx, http.MethodGet, downloadURL, opts)
+	if err != nil {
+		return Result{}, err
+	}
 
-	res, err := http.DefaultTransport.RoundTrip(r)
+	res, err := opts.httpClient().Do(req)
 	if err != nil {
-		return err
+		return Result{}, contextError(ctx, err)
 	}
 
 	defer func() { _ = res.Body.Close() }()
 
-	dataWriter(fileName, res.Body, progress)
+	opts.logger().Debug("serial response", "url", res.Request.URL.String(), "status", res.StatusCode)
 
-	return nil
-}
+	if err := checkStatus(res); err != nil {
+		return Result{}, err
+	}
+
+	if err := checkContentType(res.Header, opts); err != nil {
+		return Result{}, err
+	}
+
+	if opts.sinkAssembler() != nil {
+		written, err := serialSinkDownload(ctx, res, opts)
+
+		return Result{URL: res.Request.URL.String(), Bytes: written, Chunks: 1}, err
+	}
+
+	// The length is only used for progress reporting, so streamed responses
+	// without one, or with headers that can't be parsed, are saved all the
+	// same.
+	contentLength, knownLength := headerLength(res.Header, opts)
+
+	encoding := res.Header.Get(contentEncodingHeader)
 
-func parseURLAndCaptureFilename(downloadURL string) (string, error) {
-	u, err := url.Parse(downloadURL)
+	// A gzip file is decompressed like a gzip Content-Encoding, unless the
+	// transfer is encoded on top of it.
+	gunzip := opts.Decompress && !isEncoded(encoding) && isGzipFile(downloadURL, res.Header)
+	if gunzip {
+		encoding = "gzip"
+	}
+
+	fileName, err := resolveFileName(downloadURL, res.Header, opts)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 
-	return path.Base(u.Path), nil
-}
+	if gunzip && opts.OutputPath == "" {
+		fileName = trimGzipExt(fileName)
+	}
+
+	manifest := &Manifest{
+		URL:          downloadURL,
+		Size:         contentLength,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get(lastModifiedHeader),
+		Chunks:       1,
+	}
+
+	if upToDate(fileName, manifest, knownLength, opts) {
+		return Result{FileName: fileName}, errUpToDate
+	}
 
-func extractDownloadDetailsFromHeaders(header http.Header) (
-	filename string,
-	fileLength uint64,
-	err error,
-) {
-	fileLength, err = strconv.ParseUint(header.Get(contentLengthHeader), 10, 64)
+	fileName, err = targetFileName(fileName, opts)
 	if err != nil {
-		return
+		return Result{FileName: fileName}, err
 	}
 
-	contentDisposition := header.Get(contentDispositionHeader)
-	if len(contentDisposition) == 0 {
-		return
+	// The file only gets its real name once it is complete, so an interrupted
+	// download is never mistaken for a finished one.
+	partialFileName := partialFilePath(fileName, opts)
+
+	var offset uint64
+
+	// A resumed response only describes the rest of the file.
+	fullHeader := res.Header
+
+	if opts.Continue {
+		if resumed, resumedOffset := resumeSerial(ctx, res, partialFileName, contentLength, opts); resumed != nil {
+			_ = res.Body.Close()
+			res, offset = resumed, resumedOffset
+		}
+	}
+
+	if contentLength > 0 {
+		if err := checkSize(partialFileName, contentLength, contentLength-offset, opts); err != nil {
+			return Result{}, err
+		}
+	}
+
+	progress := newProgressWriter(opts, contentLength)
+	progress.readBytes = offset
+
+	body := opts.limitReader(ctx, res.Body)
+
+	var bodyProgress io.Writer = progress
+
+	// Progress follows the encoded bytes, which is what Content-Length counts.
+	decoded := opts.Decompress && isEncoded(encoding)
+
+	if decoded {
+		body, err = decodeBody(encoding, io.TeeReader(body, progress))
+		if err != nil {
+			return Result{}, contextError(ctx, err)
+		}
+
+		bodyProgress = io.Discard
+	}
+
+	if opts.MaxSize > 0 && !opts.Force {
+		body = &maxSizeReader{reader: body, max: opts.MaxSize, read: offset}
+	}
+
+	err = dataWriter(ctx, partialFileName, offset > 0, body, bodyProgress, opts.copyBufferSize())
+	progress.finish()
+
+	written := atomic.LoadUint64(&progress.readBytes)
+
+	if err == nil && contentLength > 0 && written != contentLength {
+		err = io.ErrUnexpectedEOF
 	}
 
-	_, params, err := mime.ParseMediaType(contentDisposition)
 	if err != nil {
-		return
+		if errors.Is(err, ErrFileTooLarge) || !keepPartial(contextError(ctx, err), opts) {
+			_ = os.Remove(partialFileName)
+		}
+
+		return Result{}, contextError(ctx, err)
 	}
 
-	filename = params["filename"]
+	// A decoded file is larger than the Content-Length of its encoding.
+	if knownLength && !decoded {
+		if err := verifyLength(partialFileName, contentLength, opts); err != nil {
+			return Result{}, err
+		}
+	}
 
-	return
-}
+	// The digest covers the encoded bytes, which a decoded file doesn't match.
+	// Trailers are only known once the body was read.
+	if !decoded && !opts.NoVerifyDigest {
+		if offset == 0 {
+			opts.digest = serverDigest(opts, fullHeader, res.Trailer)
+		} else {
+			opts.digest = serverDigest(opts, fullHeader)
+		}
+	}
 
-func getHeaders(ctx context.Context, url string) (http.Header, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	checksum, err := finishDownload(partialFileName, fileName, manifest, opts)
 	if err != nil {
-		return nil, fmt.Errorf("http.head request creation failed %w", err)
+		return Result{}, err
+	}
+
+	return completedResult(fileName, res.Request.URL.String(), written-offset, false, manifest, checksum), nil
+}
+
+// verifyLength makes sure the completed partialFileName has the expected
+// size, so a download cut short is never mistaken for a complete one.
+func verifyLength(partialFileName string, expected uint64, opts Options) error {
+	if opts.NoVerifyLength {
+		return nil
 	}
 
-	res, err := http.DefaultTransport.RoundTrip(req)
+	info, err := os.Stat(partialFileName)
 	if err != nil {
-		return nil, fmt.Errorf("http.head request failed %w", err)
+		return err
 	}
 
-	_ = res.Body.Close()
+	if size := uint64(info.Size()); size != expected {
+		if opts.RemovePartial {
+			_ = os.Remove(partialFileName)
+		}
+
+		return fmt.Errorf("%w: %d bytes on disk, expected %d", ErrLengthMismatch, size, expected)
+	}
 
-	return res.Header, nil
+	return nil
 }
 
-func formatBytes(num float64, suffix string) string {
-	const byteSize = 1024.0
+// finishDownload verifies the completed partialFileName, moves it to fileName
+// and writes its manifest when requested. A file that doesn't match its
+// checksum is removed. The checksum of the file is returned when it was hashed
+// on the way, or is empty.
+func finishDownload(partialFileName, fileName string, manifest *Manifest, opts Options) (string, error) {
+	opts, err := listedChecksum(fileName, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var sums map[string][]byte
 
-	for _, unit := range []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi"} {
-		if math.Abs(num) < byteSize {
-			return fmt.Sprintf("%3.1f %s%s", num, unit, suffix)
+	if !opts.verified {
+		// The SHA-256 of the manifest is computed in the same pass.
+		var extra []string
+		if opts.WriteManifest {
+			extra = append(extra, "sha256")
 		}
 
-		num /= byteSize
+		if sums, err = verifyContent(partialFileName, fileName, opts, extra...); err != nil {
+			if errors.Is(err, ErrChecksumMismatch) {
+				_ = os.Remove(partialFileName)
+			}
+
+			return "", err
+		}
 	}
 
-	return fmt.Sprintf("%.1f %s%s", num, "Yi", suffix)
-}
+	if opts.WriteManifest {
+		if err := manifest.complete(partialFileName, opts, sums); err != nil {
+			return "", err
+		}
+	}
+
+	if err := moveFile(partialFileName, fileName); err != nil {
+		return "", err
+	}
+
+	preserveModTime(fileName, manifest.LastModified, opts)
+
+	if opts.WriteManifest {
+		if err := writeManifest(fileName, manifest); err != nil {
+			return "", err
+		}
+	}
 
-type progressWriter struct {
-	maxBytes  uint64
-	readBytes uint64
+	return sumChecksum(sums, opts), nil
 }
 
-func (p *progressWriter) Write(data []byte) (n int, err error) {
-	const maxColumns = 80
+// verifyContent checks the completed partialFileName against the expected
+// checksum and the server's digest. The file is read once for both, and for
+// the extra algorithms whose sums are wanted as well; all sums are returned
+// by algorithm.
+func verifyContent(partialFileName, fileName string, opts Options, extra ...string) (map[string][]byte, error) {
+	checksum := opts.checksum
 
-	p.readBytes += uint64(len(data))
+	digest, err := pendingDigest(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("\r%s", strings.Repeat(" ", maxColumns))
-	fmt.Printf(
-		"\rProgress [%s/%s] (%d%%)",
-		formatBytes(float64(p.readBytes), ""),
-		formatBytes(float64(p.maxBytes), ""),
-		int(math.Ceil(float64(p.readBytes)/float64(p.maxBytes)*100.0)), //nolint:gomnd
-	)
+	algorithms := extra
 
-	return len(data), nil
-}
+	// Hashing a large file takes a while once the progress reached 100%, so
+	// it is announced as a phase of its own.
+	if checksum != nil {
+		fmt.Fprintf(opts.progressOutput(), "\nVerifying %s checksum...", checksum.algorithm)
+		opts.logger().Info("verifying checksum", "file", fileName, "algorithm", checksum.algorithm)
 
-func batchGenerator(contentLength, totalBatches uint64) func() (uint64, uint64) {
-	var (
-		m         sync.Mutex
-		start     = uint64(0)
-		batchSize = contentLength / totalBatches
-	)
+		algorithms = append(algorithms, checksum.algorithm)
+	}
 
-	return func() (uint64, uint64) {
-		m.Lock()
-		defer m.Unlock()
+	if digest != nil {
+		fmt.Fprintf(opts.progressOutput(), "\nVerifying %s digest...", digest.algorithm)
+		opts.logger().Info("verifying server digest", "file", fileName, "algorithm", digest.algorithm)
 
-		if start >= contentLength {
-			return uint64(0), uint64(0)
-		}
+		algorithms = append(algorithms, digest.algorithm)
+	}
 
-		stop := start + batchSize
-		start += batchSize
+	sums, err := hashFileSums(partialFileName, algorithms)
+	if err != nil {
+		return nil, err
+	}
 
-		if stop > contentLength {
-			stop = contentLength
+	if checksum != nil {
+		if err := checksum.verifySum(sums[checksum.algorithm]); err != nil {
+			return nil, err
 		}
+	}
 
-		return start - batchSize, stop - 1
+	if digest != nil {
+		if err := digest.verifySum(sums[digest.algorithm]); err != nil {
+			return nil, fmt.Errorf("server digest: %w", err)
+		}
 	}
+
+	return sums, nil
 }
 
-func serialDownload(ctx context.Context, downloadURL string) (string, error) {
-	fallbackFileName, err := parseURLAndCaptureFilename(downloadURL)
+// moveFile renames src to dst. A TempDir can be on another filesystem than
+// the output, where renaming fails with EXDEV; src is copied next to dst and
+// renamed there instead, so dst never holds an incomplete file.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	defer func() { _ = in.Close() }()
+
+	tmp := dst + partialFileSuffix
+
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
 	}
 
-	if fallbackFileName == "" {
-		fallbackFileName = "index.html"
+	if err == nil {
+		err = os.Rename(tmp, dst)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
 	if err != nil {
-		return "", err
+		_ = os.Remove(tmp)
+
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// preserveModTime gives fileName the server's Last-Modified time. The file
+// keeps the current time when the header is absent or unparseable.
+func preserveModTime(fileName, lastModified string, opts Options) {
+	if opts.NoPreserveTime || lastModified == "" {
+		return
 	}
 
-	res, err := http.DefaultTransport.RoundTrip(req)
+	modTime, err := http.ParseTime(lastModified)
 	if err != nil {
-		return "", err
+		opts.logger().Debug("ignoring Last-Modified", "value", lastModified, "error", err)
+
+		return
 	}
 
-	defer func() { _ = res.Body.Close() }()
+	if err := os.Chtimes(fileName, modTime, modTime); err != nil {
+		opts.logger().Info("preserving the modification time failed", "file", fileName, "error", err)
+	}
+}
 
-	fileName, contentLength, err := extractDownloadDetailsFromHeaders(res.Header)
+// remoteNewer reports whether the remote file last modified at lastModified
+// is newer than the existing fileName. It is when either time is unknown.
+func remoteNewer(fileName, lastModified string, opts Options) bool {
+	info, err := os.Stat(fileName)
 	if err != nil {
-		return "", err
+		return true
+	}
+
+	modTime, err := http.ParseTime(lastModified)
+	if err != nil {
+		opts.logger().Warn("no usable Last-Modified, downloading again", "file", fileName, "value", lastModified)
+		fmt.Fprintln(opts.progressOutput(), "Warning: the server sent no usable Last-Modified, downloading again")
+
+		return true
 	}
 
-	if fileName == "" {
-		fileName = fallbackFileName
+	// Last-Modified has a resolution of seconds.
+	return modTime.After(info.ModTime().Truncate(time.Second))
+}
+
+// resumeSerial requests the rest of an existing partial file when res
+// advertises byte ranges. It returns nil when the download has to start over
+// with res.
+func resumeSerial(
+	ctx context.Context,
+	res *http.Response,
+	partialFileName string,
+	contentLength uint64,
+	opts Options,
+) (*http.Response, uint64) {
+	acceptRanges, _ := parseAcceptRanges(res.Header.Get(acceptRangesHeader))
+
+	// Ranges address encoded bytes, which can't be appended to a decoded file.
+	if opts.Decompress || !acceptRanges {
+		return nil, 0
 	}
 
-	progress := &progressWriter{
-		maxBytes: contentLength,
+	// A meta sidecar belongs to a preallocated parallel download, whose size
+	// says nothing about its progress.
+	if _, err := os.Stat(partialFileName + metaFileSuffix); err == nil {
+		return nil, 0
 	}
 
-	dataWriter(fileName, res.Body, progress)
+	info, err := os.Stat(partialFileName)
+	if err != nil || info.Size() == 0 {
+		return nil, 0
+	}
 
-	return fileName, nil
+	// A partial file larger than the remote one belongs to another version.
+	offset := uint64(info.Size())
+	if contentLength > 0 && offset > contentLength {
+		return nil, 0
+	}
+
+	req, err := newRequest(ctx, http.MethodGet, res.Request.URL.String(), opts)
+	if err != nil {
+		return nil, 0
+	}
+
+	req.Header.Set(rangeHeader, fmt.Sprintf("bytes=%d-", offset))
+
+	if validator := rangeValidator(res.Header); validator != "" {
+		req.Header.Set(ifRangeHeader, validator)
+	}
+
+	ranged, err := opts.httpClient().Do(req)
+	if err != nil {
+		return nil, 0
+	}
+
+	// A server that still has the file of the partial one's size finds
+	// nothing left to send: the partial file is complete. Any other size
+	// means the file changed and is downloaded again.
+	if ranged.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		_ = ranged.Body.Close()
+
+		if total, ok := unsatisfiedRangeLength(ranged.Header.Get(contentRangeHeader)); !ok || total != offset {
+			return nil, 0
+		}
+
+		opts.logger().Info("partial file already complete", "file", partialFileName, "size", offset)
+		ranged.Body = http.NoBody
+
+		return ranged, offset
+	}
+
+	start, _, total, err := parseContentRange(ranged.Header.Get(contentRangeHeader))
+	if ranged.StatusCode != http.StatusPartialContent || err != nil || start != offset ||
+		(contentLength > 0 && total != contentLength) {
+		_ = ranged.Body.Close()
+
+		return nil, 0
+	}
+
+	opts.logger().Info("resuming serial download", "file", partialFileName, "offset", offset)
+
+	return ranged, offset
 }
 
+// dataWriter copies dataReader into fileName, appending to it when
+// appendData is set and replacing it otherwise. The copy stops with ctx.Err()
+// once ctx is done, even while dataReader still has data to deliver.
 func dataWriter(
+	ctx context.Context,
 	fileName string,
+	appendData bool,
 	dataReader io.Reader,
 	progressWriter io.Writer,
-) {
-	file, err := os.Create(fileName)
+	bufferSize uint64,
+) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendData {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(fileName, flag, 0666)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	defer func() { _ = file.Close() }()
+	reader := &contextReader{ctx: ctx, reader: dataReader}
 
-	_, err = io.Copy(io.MultiWriter(file, progressWriter), dataReader)
+	_, err = io.CopyBuffer(io.MultiWriter(file, progressWriter), reader, make([]byte, bufferSize))
 	if err != nil {
-		panic(err)
+		_ = file.Close()
+
+		return err
 	}
+
+	return file.Close()
 }
 
-func parallelDownload(ctx context.Context, downloadURL string, parallelRequests uint64) (string, error) {
-	fallbackFileName, err := parseURLAndCaptureFilename(downloadURL)
-	if err != nil {
-		return "", err
+// contextReader fails with the context's error once it is done, so a copy
+// observes cancellation between reads.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(data []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	headers, err := getHeaders(ctx, downloadURL)
+	return r.reader.Read(data)
+}
+
+func parallelDownload(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	remote, err := probeRemoteFile(ctx, downloadURL, opts)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 
-	if "bytes" != headers.Get("Accept-Ranges") {
-		return "", ErrNoParallelDownload
+	if opts.Decompress && opts.sinkAssembler() == nil && isGzipFile(downloadURL, remote.header) {
+		return Result{}, &NoParallelError{Reason: ReasonDecompressing}
 	}
 
-	fileName, contentLength, err := extractDownloadDetailsFromHeaders(headers)
+	// Every range request carries the validator of its mirror, so a file
+	// that changes mid-download or between resumes is never stitched from
+	// two versions.
+	mirrors, err := probeMirrors(ctx, remote, opts)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 
-	if fileName == "" {
-		fileName = fallbackFileName
+	if len(mirrors) == 0 {
+		return Result{}, &NoParallelError{Reason: remote.noParallelReason()}
 	}
 
-	var (
-		downloaderWg sync.WaitGroup
-	)
+	fileName, contentLength, validator := remote.fileName, mirrors[0].contentLength, mirrors[0].validator
+
+	if !opts.NoVerifyDigest {
+		opts.digest = serverDigest(opts, remote.header)
+	}
+
+	if opts.sinkAssembler() != nil {
+		written, chunks, err := sinkDownload(ctx, opts, contentLength, mirrors)
+
+		return Result{URL: remote.resolvedURL, Bytes: written, Parallel: true, Chunks: chunks}, err
+	}
+
+	manifest := &Manifest{
+		URL:          downloadURL,
+		Mirrors:      opts.Mirrors,
+		Size:         contentLength,
+		ETag:         remote.etag,
+		LastModified: remote.lastModified,
+	}
+
+	if upToDate(fileName, manifest, true, opts) {
+		return Result{FileName: fileName}, errUpToDate
+	}
 
-	progress := &progressWriter{
-		maxBytes: contentLength,
+	fileName, err = targetFileName(fileName, opts)
+	if err != nil {
+		return Result{FileName: fileName}, err
 	}
 
-	generator := batchGenerator(contentLength, parallelRequests)
+	partialFileName := partialFilePath(fileName, opts)
 
-	var maxFiles int
-	for {
-		startRange, stopRange := generator()
-		if startRange == 0 && stopRange == 0 {
-			break
+	// An empty file has no ranges to fetch, but still gets created and
+	// verified like any other.
+	if contentLength == 0 {
+		if err := os.WriteFile(partialFileName, nil, 0666); err != nil {
+			return Result{}, err
 		}
 
-		downloaderWg.Add(1)
+		checksum, err := finishDownload(partialFileName, fileName, manifest, opts)
+		if err != nil {
+			return Result{}, err
+		}
 
-		go func(index int, start, stop uint64) {
-			defer downloaderWg.Done()
+		return completedResult(fileName, remote.resolvedURL, 0, true, manifest, checksum), nil
+	}
 
-			err := downloadRangeBytes(
-				ctx,
-				fmt.Sprintf("%s.%d", fileName, index),
-				progress,
-				start,
-				stop,
-				downloadURL,
-			)
-			if err != nil {
-				panic(err)
-			}
-		}(maxFiles, startRange, stopRange)
+	// Chunks of an interrupted download are picked up where they stopped;
+	// otherwise the file is split into a fresh set of ranges.
+	chunks := loadPartialMeta(partialFileName, contentLength, validator)
+	if chunks == nil {
+		chunks = planChunks(contentLength, opts.chunkStrategy())
+	}
+
+	var resumedBytes uint64
 
-		maxFiles++
+	for _, c := range chunks {
+		resumedBytes += c.Written
 	}
 
-	downloaderWg.Wait()
+	if err := checkSize(partialFileName, contentLength, contentLength-resumedBytes, opts); err != nil {
+		return Result{}, err
+	}
 
-	finalFileName := fmt.Sprintf("%s.0", fileName)
-	targetFile, err := os.OpenFile(finalFileName, os.O_WRONLY|os.O_APPEND, 0666)
+	// Chunks are read back for the ChunkVerifier.
+	file, err := os.OpenFile(partialFileName, os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
-		panic(err)
+		return Result{}, err
 	}
 
-	for i := 1; i < maxFiles; i++ {
-		currentFileName := fmt.Sprintf("%s.%d", fileName, i)
-		dataFile, err := os.Open(currentFileName)
-		if err != nil {
-			panic(err)
-		}
+	if err := file.Truncate(int64(contentLength)); err != nil {
+		_ = file.Close()
+
+		return Result{}, err
+	}
 
-		_, _ = io.Copy(targetFile, dataFile)
+	progress := newProgressWriter(opts, contentLength)
+	progress.watchChunks(chunks)
 
-		_ = dataFile.Close()
-		_ = os.Remove(currentFileName)
+	progress.readBytes = resumedBytes
+
+	// A sparse file would keep the corrupt bytes a ChunkVerifier found where
+	// the new ones are zeros.
+	asm := opts.fileAssembler(file, opts.Sparse && opts.ChunkVerifier == nil)
+
+	downloadErr := downloadChunks(ctx, opts, asm, progress, chunks, mirrors)
+	if downloadErr == nil {
+		downloadErr = asm.Finalize()
 	}
-	_ = targetFile.Close()
 
-	_ = os.Rename(finalFileName, fileName)
+	progress.finish()
 
-	return fileName, nil
+	// The parts are useless when ranges turned out unsupported or belong to
+	// an outdated version or wrong size of the file, and unwanted after a
+	// permanent failure unless KeepPartial is set.
+	if errors.Is(downloadErr, ErrNoParallelDownload) || errors.Is(downloadErr, errRemoteFileChanged) ||
+		errors.Is(downloadErr, ErrSizeMismatch) || (downloadErr != nil && !keepPartial(downloadErr, opts)) {
+		_ = file.Close()
+		_ = os.Remove(partialFileName)
+		_ = os.Remove(partialFileName + metaFileSuffix)
+
+		return Result{}, downloadErr
+	}
+
+	if downloadErr != nil {
+		_ = file.Close()
+		_ = savePartialMeta(partialFileName, contentLength, validator, chunks)
+
+		return Result{}, downloadErr
+	}
+
+	if err := file.Close(); err != nil {
+		return Result{}, err
+	}
+
+	_ = os.Remove(partialFileName + metaFileSuffix)
+
+	manifest.Chunks = len(chunks)
+
+	if opts.VerifyRetries > 0 {
+		if err := repairChunks(ctx, opts, partialFileName, fileName, contentLength, chunks, mirrors); err != nil {
+			_ = os.Remove(partialFileName)
+
+			return Result{}, err
+		}
+
+		opts.verified = true
+	} else if err := verifyLength(partialFileName, contentLength, opts); err != nil {
+		return Result{}, err
+	}
+
+	checksum, err := finishDownload(partialFileName, fileName, manifest, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return completedResult(fileName, remote.resolvedURL, atomic.LoadUint64(&progress.readBytes)-resumedBytes, true, manifest, checksum), nil
 }
 
-func main() {
+// downloadChunks fetches the unwritten part of every chunk into asm using a
+// pool of opts.ParallelRequests workers spread across the mirrors and returns
+// the first error. That error cancels the requests of the other workers, since
+// the download can't complete anymore.
+func downloadChunks(
+	ctx context.Context,
+	opts Options,
+	asm Assembler,
+	progress io.Writer,
+	chunks []*chunk,
+	mirrors []mirror,
+) error {
 	var (
-		exitCode                int
-		downloadURL             string
-		parallelConnections     uint64
-		defaultParallelRequests uint64 = 5
+		downloaderWg sync.WaitGroup
+		errMutex     sync.Mutex
+		downloadErr  error
+		pool         = newMirrorPool(mirrors)
 	)
 
-	flag.StringVar(&downloadURL, "url", "", "provide the download URL")
-	flag.Uint64Var(&parallelConnections, "parallel", defaultParallelRequests, "parallel requests")
-
-	flag.Parse()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if downloadURL == "" {
-		flag.PrintDefaults()
+	// fail records the first error and stops the other workers. Their
+	// cancellation errors that follow are ignored.
+	fail := func(err error) {
+		errMutex.Lock()
+		defer errMutex.Unlock()
 
-		return
+		if downloadErr == nil {
+			downloadErr = err
+			cancel()
+		}
 	}
 
-	startTime := time.Now()
-	ctx, cancelFN := context.WithCancel(context.Background())
+	pending := make(chan *chunk, len(chunks))
+
+	for _, c := range chunks {
+		if c.remaining() > 0 {
+			pending <- c
+		}
+	}
 
-	defer func() {
-		cancelFN()
-		os.Exit(exitCode)
-	}()
+	close(pending)
 
-	fileName, err := parallelDownload(ctx, downloadURL, parallelConnections)
-	if errors.Is(err, ErrNoParallelDownload) {
-		fmt.Println("Parallel download not supported, falling back to normal download")
+	workers := opts.ParallelRequests
+	if workers > uint64(len(pending)) {
+		workers = uint64(len(pending))
+	}
 
-		fileName, err = serialDownload(ctx, downloadURL)
+	if opts.Adaptive && workers > 1 {
+		opts.adaptive = newAdaptiveLimit(int(workers), time.Now)
 	}
 
-	fmt.Println()
+	for i := uint64(0); i < workers; i++ {
+		downloaderWg.Add(1)
 
-	if err != nil {
-		fmt.Printf("Download failed with error (%s) \n", err.Error())
+		go func(worker uint64) {
+			defer downloaderWg.Done()
 
-		exitCode = -1
+			// A panicking worker fails the download like an error, so the
+			// partial file is dealt with instead of the process crashing.
+			defer func() {
+				if r := recover(); r != nil {
+					fail(fmt.Errorf("download worker panicked: %v", r))
+				}
+			}()
+
+			// The first worker starts right away, the others at random
+			// points of the ramp-up.
+			if worker > 0 && opts.RampUp > 0 {
+				if sleepContext(ctx, time.Duration(rand.Int63n(int64(opts.RampUp)))) != nil {
+					return
+				}
+			}
 
-		return
+			for c := range pending {
+				errMutex.Lock()
+				failed := downloadErr != nil
+				errMutex.Unlock()
+
+				// Once a chunk failed the download can't complete, so the
+				// remaining chunks are left for a later resume.
+				if failed {
+					continue
+				}
+
+				// An adaptive download waits for one of the requests it
+				// currently allows.
+				if opts.adaptive != nil {
+					if err := opts.adaptive.acquire(ctx); err != nil {
+						fail(err)
+
+						continue
+					}
+				}
+
+				err := downloadRangeWithRetry(ctx, opts, asm, progress, c, pool)
+
+				if opts.adaptive != nil {
+					opts.adaptive.release()
+				}
+
+				if err != nil {
+					fail(err)
+				}
+			}
+		}(i)
 	}
 
-	fmt.Printf("Downloaded filename: %s \n", fileName)
-	fmt.Printf("Total time: %d seconds \n", uint64(time.Since(startTime).Seconds()))
+	downloaderWg.Wait()
+
+	pool.logStats(opts.logger())
+
+	return downloadErr
 }
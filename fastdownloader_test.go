@@ -1,49 +1,1544 @@
-package main
+package fastdownloader
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBatchGenerator(t *testing.T) {
 	cases := []struct {
-		generator func() (uint64, uint64)
+		generator func() (uint64, uint64, bool)
 		batches   [][]int
 	}{
 		{
 			batchGenerator(uint64(11), uint64(3)),
 			[][]int{
 				{0, 3},
-				{3, 6},
-				{6, 9},
-				{9, 11},
-				{0, 0},
+				{4, 7},
+				{8, 10},
 			},
 		},
 		{
 			batchGenerator(uint64(11), uint64(2)),
 			[][]int{
 				{0, 5},
-				{5, 10},
-				{10, 11},
-				{0, 0},
+				{6, 10},
 			},
 		},
 		{
 			batchGenerator(uint64(5), uint64(1)),
 			[][]int{
-				{0, 5},
+				{0, 4},
+			},
+		},
+		{
+			batchGenerator(uint64(3), uint64(5)),
+			[][]int{
 				{0, 0},
+				{1, 1},
+				{2, 2},
 			},
 		},
+		{
+			batchGenerator(uint64(0), uint64(5)),
+			[][]int{},
+		},
 	}
 
 	for _, testCase := range cases {
 		for _, b := range testCase.batches {
-			start, stop := testCase.generator()
+			start, stop, ok := testCase.generator()
 
-			if start != uint64(b[0]) || stop != uint64(b[1]) {
+			if !ok || start != uint64(b[0]) || stop != uint64(b[1]) {
 				t.Errorf("Failed %d:%d \n", start, stop)
 			}
 		}
+
+		if start, stop, ok := testCase.generator(); ok {
+			t.Errorf("Failed unexpected batch %d:%d \n", start, stop)
+		}
+	}
+}
+
+func TestBatchGeneratorCoversContent(t *testing.T) {
+	cases := []struct {
+		contentLength uint64
+		totalBatches  uint64
+	}{
+		{1000, 3},
+		{999999, 7},
+		{1048576, 5},
+		{10, 10},
+		{7, 1},
+		{1, 1},
+		{2, 3},
+	}
+
+	for _, testCase := range cases {
+		var (
+			next    uint64
+			batches uint64
+		)
+
+		generator := batchGenerator(testCase.contentLength, testCase.totalBatches)
+
+		for {
+			start, stop, ok := generator()
+			if !ok {
+				break
+			}
+
+			// Ranges must be contiguous: no gaps and no overlaps.
+			if start != next || stop < start {
+				t.Errorf("Failed %d/%d: range %d:%d after %d \n",
+					testCase.contentLength, testCase.totalBatches, start, stop, next)
+			}
+
+			next = stop + 1
+			batches++
+		}
+
+		if next != testCase.contentLength {
+			t.Errorf("Failed %d/%d: covered %d bytes \n", testCase.contentLength, testCase.totalBatches, next)
+		}
+
+		if batches > testCase.totalBatches {
+			t.Errorf("Failed %d/%d: %d batches \n", testCase.contentLength, testCase.totalBatches, batches)
+		}
+	}
+}
+
+func TestOutputFilePath(t *testing.T) {
+	dir := t.TempDir()
+
+	cases := []struct {
+		fileName string
+		opts     Options
+		expected string
+		fails    bool
+	}{
+		{"file.zip", Options{}, "file.zip", false},
+		{"file.zip", Options{OutputDir: dir}, filepath.Join(dir, "file.zip"), false},
+		{"file.zip", Options{OutputPath: filepath.Join(dir, "other.zip")}, filepath.Join(dir, "other.zip"), false},
+		{"file.zip", Options{OutputDir: dir, OutputPath: "other.zip"}, filepath.Join(dir, "other.zip"), false},
+		{"file.zip", Options{OutputDir: filepath.Join(dir, "missing")}, "", true},
+	}
+
+	for _, testCase := range cases {
+		fileName, err := outputFilePath(testCase.fileName, testCase.opts)
+		if (err != nil) != testCase.fails {
+			t.Errorf("Unexpected error for %+v: %v \n", testCase.opts, err)
+		}
+
+		if fileName != testCase.expected {
+			t.Errorf("Failed %s != %s \n", fileName, testCase.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := []struct {
+		num      float64
+		expected string
+	}{
+		{0, "0.0 B"},
+		{1023, "1023.0 B"},
+		{1024, "1.0 KiB"},
+		{1025, "1.0 KiB"},
+		{1048576, "1.0 MiB"},
+		{-1, "-1.0 B"},
+		{-2048, "-2.0 KiB"},
+		{math.Pow(1024, 8), "1.0 YiB"},
+		{math.Pow(1024, 9), "1024.0 YiB"},
+	}
+
+	for _, testCase := range cases {
+		if formatted := FormatBytes(testCase.num, "B"); formatted != testCase.expected {
+			t.Errorf("Failed %v: %s != %s \n", testCase.num, formatted, testCase.expected)
+		}
+	}
+}
+
+func TestFormatBytesScale(t *testing.T) {
+	cases := []struct {
+		num      float64
+		scale    UnitScale
+		expected string
+	}{
+		{999, IEC, "999.0 B"},
+		{1000, IEC, "1000.0 B"},
+		{1023, IEC, "1023.0 B"},
+		{1024, IEC, "1.0 KiB"},
+		{1536, IEC, "1.5 KiB"},
+		{1 << 20, IEC, "1.0 MiB"},
+		{1 << 30, IEC, "1.0 GiB"},
+		{999, SI, "999.0 B"},
+		{1000, SI, "1.0 KB"},
+		{1023, SI, "1.0 KB"},
+		{1024, SI, "1.0 KB"},
+		{1500000, SI, "1.5 MB"},
+		{1 << 30, SI, "1.1 GB"},
+		{1e9, SI, "1.0 GB"},
+	}
+
+	for _, testCase := range cases {
+		if formatted := formatBytesScale(testCase.num, "B", testCase.scale); formatted != testCase.expected {
+			t.Errorf("Failed %v at scale %d: %s != %s \n", testCase.num, testCase.scale, formatted, testCase.expected)
+		}
+	}
+}
+
+func TestTargetFileName(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"file.zip", "file (1).zip", "archive"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		fileName string
+		opts     Options
+		expected string
+		err      error
+	}{
+		{"new.zip", Options{}, "new.zip", nil},
+		{"file.zip", Options{}, "", ErrFileExists},
+		{"file.zip", Options{Overwrite: true}, "file.zip", nil},
+		{"file.zip", Options{NoClobber: true}, "file.zip", errSkipExisting},
+		{"file.zip", Options{AutoRename: true}, "file (2).zip", nil},
+		{"archive", Options{AutoRename: true}, "archive (1)", nil},
+	}
+
+	for _, testCase := range cases {
+		fileName, err := targetFileName(filepath.Join(dir, testCase.fileName), testCase.opts)
+		if !errors.Is(err, testCase.err) || (testCase.err == nil && err != nil) {
+			t.Errorf("Failed %s %+v: error %v, expected %v \n", testCase.fileName, testCase.opts, err, testCase.err)
+		}
+
+		if testCase.expected != "" && fileName != filepath.Join(dir, testCase.expected) {
+			t.Errorf("Failed %s %+v: %s != %s \n", testCase.fileName, testCase.opts, fileName, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadExistingFile(t *testing.T) {
+	content := bytes.Repeat([]byte("new "), 1000)
+
+	cases := []struct {
+		acceptRanges bool
+		opts         Options
+		expectedFile string
+		skipped      bool
+		fails        bool
+	}{
+		{true, Options{}, "", false, true},
+		{false, Options{}, "", false, true},
+		{true, Options{Overwrite: true}, "file.bin", false, false},
+		{false, Options{NoClobber: true}, "file.bin", true, false},
+		{true, Options{AutoRename: true}, "file (1).bin", false, false},
+		{false, Options{AutoRename: true}, "file (1).bin", false, false},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		dir := t.TempDir()
+		existing := filepath.Join(dir, "file.bin")
+
+		if err := os.WriteFile(existing, []byte("old"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := testCase.opts
+		opts.OutputDir = dir
+		opts.HTTPClient = server.Client()
+		opts.ProgressOutput = io.Discard
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", opts)
+
+		server.Close()
+
+		if testCase.fails {
+			if !errors.Is(err, ErrFileExists) {
+				t.Errorf("Failed %+v: error %v, expected ErrFileExists \n", testCase.opts, err)
+			}
+		} else if err != nil {
+			t.Errorf("Failed %+v: %v \n", testCase.opts, err)
+
+			continue
+		}
+
+		if old, _ := os.ReadFile(existing); !testCase.opts.Overwrite && string(old) != "old" {
+			t.Errorf("Failed %+v: existing file changed \n", testCase.opts)
+		}
+
+		if testCase.fails {
+			continue
+		}
+
+		if result.FileName != filepath.Join(dir, testCase.expectedFile) || result.Skipped != testCase.skipped {
+			t.Errorf("Failed %+v: unexpected result %+v \n", testCase.opts, result)
+		}
+
+		if testCase.skipped {
+			continue
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed %+v: %d bytes saved, expected %d \n", testCase.opts, len(data), len(content))
+		}
+	}
+}
+
+func TestDownloadNewer(t *testing.T) {
+	content := bytes.Repeat([]byte("new "), 1000)
+	remoteTime := time.Date(2024, time.May, 6, 7, 8, 9, 0, time.UTC)
+
+	cases := []struct {
+		acceptRanges bool
+		lastModified time.Time
+		localTime    time.Time
+		upToDate     bool
+	}{
+		{true, remoteTime, remoteTime.Add(-time.Hour), false},
+		{false, remoteTime, remoteTime.Add(-time.Hour), false},
+		{true, remoteTime, remoteTime, true},
+		{false, remoteTime, remoteTime.Add(time.Hour), true},
+		// Without Last-Modified the file is always downloaded.
+		{true, time.Time{}, remoteTime, false},
+		{false, time.Time{}, remoteTime, false},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", testCase.lastModified, bytes.NewReader(content))
+
+				return
+			}
+
+			if !testCase.lastModified.IsZero() {
+				w.Header().Set("Last-Modified", testCase.lastModified.Format(http.TimeFormat))
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		dir := t.TempDir()
+		existing := filepath.Join(dir, "file.bin")
+
+		if err := os.WriteFile(existing, []byte("old"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(existing, testCase.localTime, testCase.localTime); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Newer:          true,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Errorf("Failed %+v: %v \n", testCase, err)
+
+			continue
+		}
+
+		if result.UpToDate != testCase.upToDate || result.Skipped != testCase.upToDate {
+			t.Errorf("Failed %+v: unexpected result %+v \n", testCase, result)
+		}
+
+		expected := content
+		if testCase.upToDate {
+			expected = []byte("old")
+		}
+
+		if data, _ := os.ReadFile(existing); !bytes.Equal(data, expected) {
+			t.Errorf("Failed %+v: %d bytes in the file, expected %d \n", testCase, len(data), len(expected))
+		}
+	}
+}
+
+func TestDownloadEmptyFile(t *testing.T) {
+	for _, acceptRanges := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only the range probe may ask for bytes.
+			if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && rangeHeader != "bytes=0-0" {
+				t.Errorf("Failed range request %s for an empty file \n", rangeHeader)
+			}
+
+			if acceptRanges {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+
+			w.Header().Set("Content-Length", "0")
+		}))
+
+		var output strings.Builder
+
+		result, err := Download(context.Background(), server.URL+"/empty.bin", Options{
+			OutputDir:      t.TempDir(),
+			HTTPClient:     server.Client(),
+			Checksum:       "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			ProgressOutput: &output,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Errorf("Failed accept ranges %t: %v \n", acceptRanges, err)
+
+			continue
+		}
+
+		info, err := os.Stat(result.FileName)
+		if err != nil || info.Size() != 0 || result.Bytes != 0 {
+			t.Errorf("Failed accept ranges %t: %+v %v \n", acceptRanges, result, err)
+		}
+
+		if strings.Contains(output.String(), "NaN") || strings.Contains(output.String(), "Inf") {
+			t.Errorf("Failed accept ranges %t: progress %q \n", acceptRanges, output.String())
+		}
+	}
+}
+
+func TestDownloadNoFallback(t *testing.T) {
+	content := bytes.Repeat([]byte("serial "), 1000)
+
+	cases := []struct {
+		acceptRanges bool
+		reason       NoParallelReason
+	}{
+		{false, ReasonNoAcceptRanges},
+		{true, ReasonNoContentLength},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+
+			// Flushing before writing drops the Content-Length.
+			w.(http.Flusher).Flush()
+			_, _ = w.Write(content)
+		}))
+
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      dir,
+			HTTPClient:     server.Client(),
+			NoFallback:     true,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		var noParallel *NoParallelError
+
+		if !errors.Is(err, ErrNoParallelDownload) || !errors.As(err, &noParallel) || noParallel.Reason != testCase.reason {
+			t.Errorf("Failed %+v: error %v \n", testCase, err)
+		}
+
+		if err != nil && !strings.Contains(err.Error(), testCase.reason.String()) {
+			t.Errorf("Failed %+v: %q doesn't explain the reason \n", testCase, err)
+		}
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Failed %+v: %d files written \n", testCase, len(entries))
+		}
+	}
+}
+
+func TestNoParallelError(t *testing.T) {
+	err := fmt.Errorf("chunk 2: %w", &NoParallelError{Reason: ReasonRangeIgnored, Status: "200 OK"})
+
+	if !errors.Is(err, ErrNoParallelDownload) {
+		t.Errorf("Failed %v doesn't match ErrNoParallelDownload \n", err)
+	}
+
+	var noParallel *NoParallelError
+	if !errors.As(err, &noParallel) || noParallel.Reason != ReasonRangeIgnored {
+		t.Errorf("Failed reason of %v not extracted \n", err)
+	}
+
+	expected := "chunk 2: parallel download not supported: range request answered with 200 OK"
+	if err.Error() != expected {
+		t.Errorf("Failed %q != %q \n", err.Error(), expected)
+	}
+}
+
+func TestDownloadWithoutContentLength(t *testing.T) {
+	content := bytes.Repeat([]byte("chunked "), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(content); i += 1000 {
+			_, _ = w.Write(content[i : i+1000])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/stream.txt", Options{
+		OutputDir:      t.TempDir(),
+		HTTPClient:     server.Client(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, expected %d \n", len(data), len(content))
+	}
+}
+
+func TestDownloadIgnoresMalformedContentDisposition(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// Without range support the file is saved by a single request, which
+	// still knows the total for its progress.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="unterminated`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	var progress bytes.Buffer
+
+	result, err := Download(context.Background(), server.URL+"/from-url.bin", Options{
+		OutputDir:      t.TempDir(),
+		ProgressOutput: &progress,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(result.FileName) != "from-url.bin" {
+		t.Errorf("Failed saved as %s, expected from-url.bin \n", result.FileName)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(content))
+	}
+
+	if !strings.Contains(progress.String(), "/64.0 Ki] (100%)") {
+		t.Errorf("Failed progress without the total: %q \n", progress.String())
+	}
+}
+
+func TestVerifyLength(t *testing.T) {
+	cases := []struct {
+		opts     Options
+		expected uint64
+		fail     bool
+		kept     bool
+	}{
+		{Options{}, 10, false, true},
+		{Options{}, 12, true, true},
+		{Options{RemovePartial: true}, 12, true, false},
+		{Options{NoVerifyLength: true}, 12, false, true},
+	}
+
+	for _, testCase := range cases {
+		fileName := filepath.Join(t.TempDir(), "file.bin"+partialFileSuffix)
+		if err := os.WriteFile(fileName, []byte("0123456789"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		err := verifyLength(fileName, testCase.expected, testCase.opts)
+		if errors.Is(err, ErrLengthMismatch) != testCase.fail {
+			t.Errorf("Failed %+v: %v \n", testCase, err)
+		}
+
+		if fileExists(fileName) != testCase.kept {
+			t.Errorf("Failed %+v: partial file kept %t \n", testCase, fileExists(fileName))
+		}
+	}
+}
+
+func TestDownloadTruncatedChunk(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// The second chunk's response claims its full range but ends early, with
+	// a Content-Length matching the short body.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=16384-32767" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 16384-32767/%d", len(content)))
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[16384:17384])
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		Chunks:         4,
+		OutputDir:      dir,
+		ProgressOutput: io.Discard,
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Failed %v, expected unexpected EOF \n", err)
+	}
+
+	if fileExists(filepath.Join(dir, "file.bin")) {
+		t.Errorf("Failed incomplete file saved \n")
+	}
+}
+
+func TestDownloadFollowsRedirects(t *testing.T) {
+	var redirects int32
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&redirects, 1)
+		http.Redirect(w, r, "/file.bin", http.StatusFound)
+	})
+	mux.HandleFunc("/file.bin", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	result, err := parallelDownload(context.Background(), server.URL+"/redirect", Options{
+		ParallelRequests: 4,
+		OutputDir:        t.TempDir(),
+		HTTPClient:       server.Client(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, expected %d \n", len(data), len(content))
+	}
+
+	if redirects != 1 {
+		t.Errorf("Failed redirect followed %d times, expected once \n", redirects)
+	}
+}
+
+func TestProgressGoesToStderr(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func(r io.Reader) <-chan []byte {
+		result := make(chan []byte, 1)
+
+		go func() {
+			data, _ := io.ReadAll(r)
+			result <- data
+		}()
+
+		return result
+	}
+
+	stdoutResult, stderrResult := readAll(stdoutReader), readAll(stderrReader)
+
+	stdout, stderr, defaultOutput := os.Stdout, os.Stderr, DefaultProgressOutput
+	os.Stdout, os.Stderr, DefaultProgressOutput = stdoutWriter, stderrWriter, stderrWriter
+
+	_, err = Download(context.Background(), server.URL+"/file.bin", Options{
+		OutputDir:  t.TempDir(),
+		HTTPClient: server.Client(),
+	})
+
+	os.Stdout, os.Stderr, DefaultProgressOutput = stdout, stderr, defaultOutput
+
+	_ = stdoutWriter.Close()
+	_ = stderrWriter.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutData, stderrData := <-stdoutResult, <-stderrResult
+
+	if len(stdoutData) != 0 {
+		t.Errorf("Failed progress written to stdout: %q \n", stdoutData)
+	}
+
+	if !bytes.Contains(stderrData, []byte("Progress [")) {
+		t.Errorf("Failed progress not written to stderr: %q \n", stderrData)
+	}
+
+	if defaultOutput != io.Writer(os.Stderr) {
+		t.Errorf("Failed default progress output is not stderr \n")
+	}
+}
+
+func TestExtractDownloadDetailsSanitizesFilename(t *testing.T) {
+	cases := []struct {
+		contentDisposition string
+		expected           string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename="../../etc/cron.d/x"`, ""},
+		{`attachment; filename="/etc/passwd"`, ""},
+		{`attachment; filename="..\\windows\\x.dll"`, ""},
+		{`attachment; filename=".."`, ""},
+		{`attachment; filename="archive..tar"`, "archive..tar"},
+		{`attachment; filename=""`, ""},
+		{`attachment; filename="  "`, ""},
+		{`attachment; filename*=UTF-8''..%2F..%2Fetc%2Fx`, ""},
+		{`attachment; filename*=UTF-8''safe%20name.txt`, "safe name.txt"},
+	}
+
+	for _, testCase := range cases {
+		header := http.Header{}
+		header.Set(contentLengthHeader, "10")
+		header.Set(contentDispositionHeader, testCase.contentDisposition)
+
+		fileName, err := headerFileName(header)
+		if err != nil {
+			t.Errorf("Failed %s: %v \n", testCase.contentDisposition, err)
+		}
+
+		if fileName != testCase.expected {
+			t.Errorf("Failed %s: %q != %q \n", testCase.contentDisposition, fileName, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", "1000")
+
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		// Send a few bytes and stall until the client gives up.
+		_, _ = w.Write([]byte("slow"))
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := Download(ctx, server.URL+"/slow.bin", Options{
+		OutputDir:      t.TempDir(),
+		HTTPClient:     server.Client(),
+		ProgressOutput: io.Discard,
+		Retries:        3,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Failed expected deadline exceeded, got %v \n", err)
+	}
+}
+
+// endlessReader delivers data forever without blocking, calling onRead after
+// every read.
+type endlessReader struct {
+	reads  int
+	onRead func(reads int)
+}
+
+func (r *endlessReader) Read(data []byte) (int, error) {
+	r.reads++
+	r.onRead(r.reads)
+
+	return len(data), nil
+}
+
+func TestDataWriterStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &endlessReader{onRead: func(reads int) {
+		if reads == 10 {
+			cancel()
+		}
+	}}
+
+	err := dataWriter(ctx, filepath.Join(t.TempDir(), "endless.bin"), false, reader, io.Discard, 1024)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Failed expected context canceled, got %v \n", err)
+	}
+
+	if reader.reads != 10 {
+		t.Errorf("Failed %d reads, expected the copy to stop after 10 \n", reader.reads)
+	}
+}
+
+func TestChunksDecoupledFromConcurrency(t *testing.T) {
+	var (
+		inFlight    int32
+		maxInFlight int32
+		requests    int32
+	)
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&requests, 1)
+
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+
+			for {
+				previous := atomic.LoadInt32(&maxInFlight)
+				if current <= previous || atomic.CompareAndSwapInt32(&maxInFlight, previous, current) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 3,
+		Chunks:           20,
+		OutputDir:        t.TempDir(),
+		HTTPClient:       server.Client(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, expected %d \n", len(data), len(content))
+	}
+
+	if result.Bytes != uint64(len(content)) {
+		t.Errorf("Failed %d bytes reported, expected %d \n", result.Bytes, len(content))
+	}
+
+	if requests < 20 {
+		t.Errorf("Failed %d range requests, expected at least 20 \n", requests)
+	}
+
+	if maxInFlight > 3 {
+		t.Errorf("Failed %d simultaneous requests, expected at most 3 \n", maxInFlight)
+	}
+}
+
+func TestDownloadFallsBackWhenRangesAreIgnored(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ranges are advertised but every GET returns the whole file.
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		OutputDir:      dir,
+		HTTPClient:     server.Client(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, expected %d \n", len(data), len(content))
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Failed %d files left in the output directory \n", len(entries))
+	}
+}
+
+func TestDownloadRestartsWhenRemoteFileChanged(t *testing.T) {
+	oldContent := bytes.Repeat([]byte("old "), 250)
+	newContent := bytes.Repeat([]byte("new "), 250)
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The file is replaced right after the first probe.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(oldContent))
+
+			return
+		}
+
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(newContent))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		OutputDir:      dir,
+		HTTPClient:     server.Client(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, newContent) {
+		t.Errorf("Failed download mixes file versions \n")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Failed %d files left in the output directory \n", len(entries))
+	}
+}
+
+func BenchmarkSerialDownload(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4*1024*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	for _, bufferSize := range []uint64{32 * 1024, 1024 * 1024} {
+		b.Run(FormatBytes(float64(bufferSize), "B"), func(b *testing.B) {
+			opts := Options{
+				OutputDir:      b.TempDir(),
+				HTTPClient:     server.Client(),
+				BufferSize:     bufferSize,
+				ProgressOutput: io.Discard,
+			}
+
+			b.SetBytes(int64(len(content)))
+
+			for i := 0; i < b.N; i++ {
+				if _, err := serialDownload(context.Background(), server.URL+"/file.bin", opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadPreservesModTime(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	modTime := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	cases := []struct {
+		acceptRanges   bool
+		lastModified   string
+		noPreserveTime bool
+		preserved      bool
+	}{
+		{true, "", false, true},
+		{false, modTime.Format(http.TimeFormat), false, true},
+		{true, "", true, false},
+		{false, "yesterday", false, false},
+		{false, "", false, false},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// ServeContent sets Last-Modified and honors If-Range itself.
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+
+				return
+			}
+
+			if testCase.lastModified != "" {
+				w.Header().Set("Last-Modified", testCase.lastModified)
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      t.TempDir(),
+			HTTPClient:     server.Client(),
+			NoPreserveTime: testCase.noPreserveTime,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(result.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.ModTime().Equal(modTime) != testCase.preserved {
+			t.Errorf("Failed %+v: modification time %s \n", testCase, info.ModTime())
+		}
+	}
+}
+
+func TestSerialDownloadPartialFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection is closed after half of the announced length.
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content[:len(content)/2])
+	}))
+	defer server.Close()
+
+	for _, removePartial := range []bool{false, true} {
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      dir,
+			HTTPClient:     server.Client(),
+			RemovePartial:  removePartial,
+			ProgressOutput: io.Discard,
+		})
+		if err == nil {
+			t.Fatalf("Failed truncated download succeeded \n")
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "file.bin")); !os.IsNotExist(err) {
+			t.Errorf("Failed remove partial %t: truncated file saved under the final name \n", removePartial)
+		}
+
+		_, err = os.Stat(filepath.Join(dir, "file.bin"+partialFileSuffix))
+		if os.IsNotExist(err) != removePartial {
+			t.Errorf("Failed remove partial %t: partial file %v \n", removePartial, err)
+		}
+	}
+}
+
+func TestParallelDownloadPartialFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	cases := []struct {
+		status      int
+		keepPartial bool
+		kept        bool
+	}{
+		// A missing file won't come back, a failing server may.
+		{http.StatusNotFound, false, false},
+		{http.StatusNotFound, true, true},
+		{http.StatusServiceUnavailable, false, true},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The probe succeeds, the chunk from the middle on fails.
+			if strings.HasPrefix(r.Header.Get("Range"), "bytes=5000-") {
+				w.WriteHeader(testCase.status)
+
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 2,
+			Chunks:           2,
+			KeepPartial:      testCase.keepPartial,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if err == nil {
+			t.Fatalf("Failed %+v: download succeeded \n", testCase)
+		}
+
+		partialFileName := filepath.Join(dir, "file.bin"+partialFileSuffix)
+
+		if fileExists(partialFileName) != testCase.kept || fileExists(partialFileName+metaFileSuffix) != testCase.kept {
+			t.Errorf("Failed %+v: partial file kept %t \n", testCase, fileExists(partialFileName))
+		}
+	}
+}
+
+func TestDownloadChunksCancelsOnFailure(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.Header.Get("Range"), "bytes=5000-"):
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		case strings.HasPrefix(r.Header.Get("Range"), "bytes=0-"):
+			// The first chunk stalls until the failure of the second one
+			// cancels it.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	started := time.Now()
+
+	_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 2,
+		Chunks:           2,
+		OutputDir:        t.TempDir(),
+		ProgressOutput:   io.Discard,
+	})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Failed %v, expected the 404 of the failing chunk \n", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Failed the stalled chunk wasn't canceled, took %s \n", elapsed)
+	}
+}
+
+func TestDownloadTempDir(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	for _, truncated := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if truncated {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				_, _ = w.Write(content[:len(content)/2])
+
+				return
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir, tempDir := t.TempDir(), t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			TempDir:        tempDir,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if truncated {
+			// The partial file waits in TempDir for a resume.
+			if err == nil || !fileExists(filepath.Join(tempDir, "file.bin"+partialFileSuffix)) {
+				t.Errorf("Failed truncated download: %v, partial file not in TempDir \n", err)
+			}
+
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Failed %d files in the output directory \n", len(entries))
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); result.FileName != filepath.Join(dir, "file.bin") || !bytes.Equal(data, content) {
+			t.Errorf("Failed saved as %s with %d bytes \n", result.FileName, len(data))
+		}
+
+		if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+			t.Errorf("Failed %d files left in TempDir \n", len(entries))
+		}
+	}
+}
+
+func TestMoveFileAcrossFilesystems(t *testing.T) {
+	// /dev/shm is a tmpfs on most Linux systems, so renaming from there to
+	// a test directory fails with EXDEV.
+	srcDir, err := os.MkdirTemp("/dev/shm", "fastdownloader-test-*")
+	if err != nil {
+		t.Skip("no /dev/shm:", err)
+	}
+
+	defer func() { _ = os.RemoveAll(srcDir) }()
+
+	src, dst := filepath.Join(srcDir, "file.bin"), filepath.Join(t.TempDir(), "file.bin")
+
+	if err := os.WriteFile(src, []byte("content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(dst); string(data) != "content" {
+		t.Errorf("Failed %q moved \n", data)
+	}
+
+	if fileExists(src) || fileExists(dst+partialFileSuffix) {
+		t.Errorf("Failed source or temporary copy left behind \n")
+	}
+}
+
+func TestSerialDownloadContinue(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, resume := range []bool{false, true} {
+		var resumedAt int32 = -1
+
+		// The body is streamed without a length, which rules out a parallel
+		// download, but open ended ranges are served.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Accept-Ranges", "bytes")
+
+			var offset int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err == nil && offset > 0 {
+				atomic.StoreInt32(&resumedAt, int32(offset))
+
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write(content[offset:])
+
+				return
+			}
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(content[:100])
+				w.(http.Flusher).Flush()
+				_, _ = w.Write(content[100:])
+			}
+		}))
+
+		dir := t.TempDir()
+
+		if err := os.WriteFile(filepath.Join(dir, "file.bin"+partialFileSuffix), content[:300], 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      dir,
+			HTTPClient:     server.Client(),
+			Continue:       resume,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(result.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Failed continue %t: %d bytes saved, expected %d \n", resume, len(data), len(content))
+		}
+
+		expectedBytes, expectedOffset := uint64(len(content)), int32(-1)
+		if resume {
+			expectedBytes, expectedOffset = uint64(len(content)-300), 300
+		}
+
+		if result.Bytes != expectedBytes || resumedAt != expectedOffset {
+			t.Errorf("Failed continue %t: %d bytes from offset %d \n", resume, result.Bytes, resumedAt)
+		}
+	}
+}
+
+func TestDownloadMethodAndBody(t *testing.T) {
+	files := map[string][]byte{
+		`{"id":1}`: bytes.Repeat([]byte("first file "), 3000),
+		`{"id":2}`: bytes.Repeat([]byte("second file "), 3000),
+	}
+
+	cases := []struct {
+		name         string
+		method       string
+		body         string
+		acceptRanges bool
+		parallel     bool
+	}{
+		{"post", "", `{"id":1}`, true, true},
+		{"put", http.MethodPut, `{"id":2}`, true, true},
+		// Ranges ignored on POST fall back to a single request.
+		{"serial", "", `{"id":2}`, false, false},
+	}
+
+	for _, testCase := range cases {
+		expectedMethod := testCase.method
+		if expectedMethod == "" {
+			expectedMethod = http.MethodPost
+		}
+
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+
+			body, _ := io.ReadAll(r.Body)
+
+			content, ok := files[string(body)]
+			if r.Method != expectedMethod || !ok {
+				t.Errorf("Failed %s: unexpected %s request with %q \n", testCase.name, r.Method, body)
+				http.Error(w, "bad request", http.StatusBadRequest)
+
+				return
+			}
+
+			if !testCase.acceptRanges {
+				_, _ = w.Write(content)
+
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/query", Options{
+			ParallelRequests: 4,
+			Method:           testCase.method,
+			Body:             []byte(testCase.body),
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, files[testCase.body]) {
+			t.Errorf("Failed %s: downloaded %d bytes, expected %d \n", testCase.name, len(data), len(files[testCase.body]))
+		}
+
+		if result.Parallel != testCase.parallel {
+			t.Errorf("Failed %s: parallel %t, expected %t \n", testCase.name, result.Parallel, testCase.parallel)
+		}
+
+		// The range probe and one request per chunk, or the probe and the
+		// serial download.
+		expected := int32(2)
+		if testCase.parallel {
+			expected = 5
+		}
+
+		if requests.Load() != expected {
+			t.Errorf("Failed %s: %d requests, expected %d \n", testCase.name, requests.Load(), expected)
+		}
+	}
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	cases := []struct {
+		name    string
+		partial []byte
+		bytes   uint64
+	}{
+		// Nothing is left to fetch from a complete partial file.
+		{"complete", content, 0},
+		// A partial file larger than the remote one is of another version
+		// and is replaced.
+		{"shrunk", append(bytes.Repeat([]byte("x"), 1000), "more"...), uint64(len(content))},
+	}
+
+	for _, testCase := range cases {
+		var unsatisfiable atomic.Int32
+
+		// The body is streamed without a length, so only the range request
+		// tells the size, and just open ended ranges are served.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Accept-Ranges", "bytes")
+
+			var offset int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err == nil && offset > 0 {
+				if offset >= len(content) {
+					unsatisfiable.Add(1)
+				}
+
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(content[:100])
+				w.(http.Flusher).Flush()
+				_, _ = w.Write(content[100:])
+			}
+		}))
+
+		dir := t.TempDir()
+
+		if err := os.WriteFile(filepath.Join(dir, "file.bin"+partialFileSuffix), testCase.partial, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			OutputDir:      dir,
+			Continue:       true,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: %d bytes saved, expected %d \n", testCase.name, len(data), len(content))
+		}
+
+		if result.Bytes != testCase.bytes || unsatisfiable.Load() != 1 {
+			t.Errorf("Failed %s: %d bytes downloaded, %d unsatisfiable ranges \n", testCase.name, result.Bytes, unsatisfiable.Load())
+		}
+	}
+}
+
+func TestParallelDownloadFileShrunk(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	shrunk := content[:len(content)/2]
+
+	var probes, unsatisfiable atomic.Int32
+
+	// The first probe still sees the whole file, which has half its size by
+	// the time the chunks are requested.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && probes.Add(1) == 1 {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+
+			return
+		}
+
+		recorder := httptest.NewRecorder()
+		http.ServeContent(recorder, r, "", time.Time{}, bytes.NewReader(shrunk))
+
+		if recorder.Code == http.StatusRequestedRangeNotSatisfiable {
+			unsatisfiable.Add(1)
+		}
+
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 4,
+		OutputDir:        t.TempDir(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, shrunk) {
+		t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(shrunk))
+	}
+
+	// The download restarted with a new probe after the 416.
+	if unsatisfiable.Load() == 0 || probes.Load() != 2 {
+		t.Errorf("Failed %d unsatisfiable ranges, %d probes \n", unsatisfiable.Load(), probes.Load())
 	}
 }
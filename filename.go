@@ -0,0 +1,185 @@
+package fastdownloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFileName names downloads whose URL and headers don't suggest a name,
+// like a site's root, unless another default is set.
+const defaultFileName = "index.html"
+
+// FilenameResolver picks the name a download is saved under, e.g. to add a
+// timestamp or to derive the extension from the Content-Type. It receives the
+// download URL and the headers of the response, or of the probe of a parallel
+// download. The name must be a plain file name; it is created in OutputDir.
+type FilenameResolver interface {
+	ResolveFilename(downloadURL string, header http.Header) (string, error)
+}
+
+// FilenameResolverFunc adapts a function to a FilenameResolver.
+type FilenameResolverFunc func(downloadURL string, header http.Header) (string, error)
+
+func (f FilenameResolverFunc) ResolveFilename(downloadURL string, header http.Header) (string, error) {
+	return f(downloadURL, header)
+}
+
+// DefaultFilenameResolver names a download after the file name of its
+// Content-Disposition header, the last segment of the URL path or
+// DefaultName, in that order. Names that could escape the output directory
+// and malformed headers are passed over.
+type DefaultFilenameResolver struct {
+	// DefaultName names downloads whose URL path ends without a file name,
+	// "index.html" when empty. "{host}" in it is replaced by the host name of
+	// the URL and "{time}" by the current time as 20060102-150405.
+	DefaultName string
+}
+
+func (r DefaultFilenameResolver) ResolveFilename(downloadURL string, header http.Header) (string, error) {
+	if fileName, err := headerFileName(header); err == nil && fileName != "" {
+		return fileName, nil
+	}
+
+	fileName, err := parseURLAndCaptureFilename(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	if fileName != "" {
+		return fileName, nil
+	}
+
+	if r.DefaultName == "" {
+		return defaultFileName, nil
+	}
+
+	return expandDefaultName(r.DefaultName, downloadURL, time.Now())
+}
+
+// expandDefaultName fills the placeholders of a DefaultName for downloadURL.
+func expandDefaultName(name, downloadURL string, now time.Time) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.NewReplacer(
+		"{host}", u.Hostname(),
+		"{time}", now.Format("20060102-150405"),
+	).Replace(name), nil
+}
+
+// resolveFileName returns the path a download of downloadURL is saved to.
+// Options.OutputPath takes precedence over the FilenameResolver, which isn't
+// consulted then.
+func resolveFileName(downloadURL string, header http.Header, opts Options) (string, error) {
+	if opts.OutputPath != "" {
+		return outputFilePath("", opts)
+	}
+
+	resolver := opts.FilenameResolver
+	if resolver == nil {
+		resolver = DefaultFilenameResolver{DefaultName: opts.DefaultFileName}
+
+		if _, err := headerFileName(header); err != nil {
+			opts.logger().Info("ignoring Content-Disposition", "value", header.Get(contentDispositionHeader), "error", err)
+		}
+	}
+
+	name, err := resolver.ResolveFilename(downloadURL, header)
+	if err != nil {
+		return "", fmt.Errorf("resolving the file name failed: %w", err)
+	}
+
+	fileName := sanitizeFileName(name)
+	if fileName == "" {
+		return "", fmt.Errorf("resolved file name %q isn't a plain file name", name)
+	}
+
+	fileName, err = expandOutputTemplate(fileName, downloadURL, opts, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return preservedFilePath(downloadURL, fileName, opts)
+}
+
+// preservedFilePath returns the path fileName is saved to, below the
+// directories of the URL path when Options.PreservePath is set. They are
+// created later, by targetFileName.
+func preservedFilePath(downloadURL, fileName string, opts Options) (string, error) {
+	filePath, err := outputFilePath(fileName, opts)
+	if err != nil || !opts.PreservePath || opts.OutputPath != "" {
+		return filePath, err
+	}
+
+	dir, err := urlDir(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(filePath), dir, fileName), nil
+}
+
+// urlDir returns the directories of the URL path of downloadURL as a relative
+// path, e.g. "a/b" for https://example.com/a/b/file.bin. Segments that could
+// escape the output directory, like "..", are dropped.
+func urlDir(downloadURL string) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	var dirs []string
+
+	for _, segment := range strings.Split(path.Dir(u.Path), "/") {
+		if segment = sanitizeFileName(segment); segment != "" {
+			dirs = append(dirs, segment)
+		}
+	}
+
+	return filepath.Join(dirs...), nil
+}
+
+func parseURLAndCaptureFilename(downloadURL string) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeFileName(path.Base(u.Path)), nil
+}
+
+// sanitizeFileName returns name if it is safe to create in the output
+// directory, or an empty string when it could escape it, e.g. "../x" or an
+// absolute path. Callers fall back to another name in that case.
+func sanitizeFileName(name string) string {
+	name = strings.TrimSpace(name)
+
+	if strings.ContainsAny(name, `/\`) || name == "" || name == "." || name == ".." {
+		return ""
+	}
+
+	return filepath.Base(name)
+}
+
+// headerFileName returns the sanitized Content-Disposition file name, or ""
+// when the header is absent or names no usable file.
+func headerFileName(header http.Header) (string, error) {
+	contentDisposition := header.Get(contentDispositionHeader)
+	if len(contentDisposition) == 0 {
+		return "", nil
+	}
+
+	filename, err := contentDispositionFilename(contentDisposition)
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeFileName(filename), nil
+}
@@ -0,0 +1,270 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultFilenameResolver(t *testing.T) {
+	cases := []struct {
+		url                string
+		contentDisposition string
+		expected           string
+	}{
+		// Content-Disposition takes precedence over the URL.
+		{"https://example.com/from-url.bin", `attachment; filename="report.pdf"`, "report.pdf"},
+		// Unusable or malformed headers fall back to the URL.
+		{"https://example.com/from-url.bin", `attachment; filename="../../etc/passwd"`, "from-url.bin"},
+		{"https://example.com/from-url.bin", `attachment; filename="unterminated`, "from-url.bin"},
+		{"https://example.com/dir/from-url.bin?x=1", "", "from-url.bin"},
+		// URLs without a file name are saved as index.html.
+		{"https://example.com/", "", "index.html"},
+		{"https://example.com", "", "index.html"},
+		{"https://example.com/dir/", `attachment; filename=""`, "dir"},
+	}
+
+	for _, testCase := range cases {
+		header := http.Header{}
+		if testCase.contentDisposition != "" {
+			header.Set(contentDispositionHeader, testCase.contentDisposition)
+		}
+
+		fileName, err := DefaultFilenameResolver{}.ResolveFilename(testCase.url, header)
+		if err != nil || fileName != testCase.expected {
+			t.Errorf("Failed %s %s: %q, %v, expected %q \n",
+				testCase.url, testCase.contentDisposition, fileName, err, testCase.expected)
+		}
+	}
+}
+
+func TestResolveFileName(t *testing.T) {
+	dir := t.TempDir()
+
+	resolver := FilenameResolverFunc(func(downloadURL string, header http.Header) (string, error) {
+		switch header.Get("Content-Type") {
+		case "application/pdf":
+			return "custom.pdf", nil
+		case "text/plain":
+			return "../escape.txt", nil
+		}
+
+		return "", errors.New("unknown type")
+	})
+
+	cases := []struct {
+		contentType string
+		opts        Options
+		expected    string
+	}{
+		{"application/pdf", Options{FilenameResolver: resolver}, "custom.pdf"},
+		{"text/plain", Options{FilenameResolver: resolver}, ""},
+		{"image/png", Options{FilenameResolver: resolver}, ""},
+		// OutputPath wins without asking the resolver.
+		{"image/png", Options{FilenameResolver: resolver, OutputPath: "out.bin"}, "out.bin"},
+	}
+
+	for _, testCase := range cases {
+		testCase.opts.OutputDir = dir
+
+		header := http.Header{}
+		header.Set("Content-Type", testCase.contentType)
+
+		fileName, err := resolveFileName("https://example.com/file.bin", header, testCase.opts)
+
+		if testCase.expected == "" && err == nil {
+			t.Errorf("Failed %s: %q accepted \n", testCase.contentType, fileName)
+		}
+
+		if testCase.expected != "" && (err != nil || fileName != filepath.Join(dir, testCase.expected)) {
+			t.Errorf("Failed %s: %q, %v, expected %q \n", testCase.contentType, fileName, err, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadFilenameResolver(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	for _, acceptRanges := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-tar")
+
+			if acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/archive", Options{
+			FilenameResolver: FilenameResolverFunc(func(downloadURL string, header http.Header) (string, error) {
+				return strings.TrimPrefix(downloadURL, server.URL+"/") + ".tar", nil
+			}),
+			OutputDir:      t.TempDir(),
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed accept ranges %t: %v \n", acceptRanges, err)
+		}
+
+		if filepath.Base(result.FileName) != "archive.tar" {
+			t.Errorf("Failed accept ranges %t: saved as %s, expected archive.tar \n", acceptRanges, result.FileName)
+		}
+	}
+}
+
+func TestURLDir(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/a/b/file.bin", filepath.Join("a", "b")},
+		{"https://example.com/file.bin", ""},
+		{"https://example.com/", ""},
+		{"https://example.com/a//b/./file.bin?x=/y", filepath.Join("a", "b")},
+		// Nothing may climb out of the output directory.
+		{"https://example.com/../../etc/passwd", "etc"},
+		{"https://example.com/a/%2e%2e/%2e%2e/b/file.bin", "b"},
+		{"https://example.com/a%2F..%2F..%2Fb/file.bin", "b"},
+		{`https://example.com/a\..\b/file.bin`, ""},
+	}
+
+	for _, testCase := range cases {
+		dir, err := urlDir(testCase.url)
+		if err != nil || dir != testCase.expected {
+			t.Errorf("Failed %s: %q, %v, expected %q \n", testCase.url, dir, err, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadPreservePath(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, preservePath := range []bool{true, false} {
+		dir := t.TempDir()
+
+		opts := Options{
+			PreservePath:   preservePath,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		}
+
+		plan, err := Plan(context.Background(), server.URL+"/a/b/file.bin", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := filepath.Join(dir, "file.bin")
+		if preservePath {
+			expected = filepath.Join(dir, "a", "b", "file.bin")
+
+			if _, err := os.Stat(filepath.Join(dir, "a")); err == nil {
+				t.Errorf("Failed the dry run created the directories \n")
+			}
+		}
+
+		if plan.FileName != expected {
+			t.Errorf("Failed preserve path %t: planned %s, expected %s \n", preservePath, plan.FileName, expected)
+		}
+
+		result, err := Download(context.Background(), server.URL+"/a/b/file.bin", opts)
+		if err != nil {
+			t.Fatalf("Failed preserve path %t: %v \n", preservePath, err)
+		}
+
+		data, err := os.ReadFile(expected)
+		if err != nil || result.FileName != expected || !bytes.Equal(data, content) {
+			t.Errorf("Failed preserve path %t: saved as %s, %v \n", preservePath, result.FileName, err)
+		}
+	}
+}
+
+func TestExpandDefaultName(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"download.bin", "https://example.com/", "download.bin"},
+		{"{host}.html", "https://example.com:8443/", "example.com.html"},
+		{"{host}-{time}.html", "https://example.com", "example.com-20240304-050607.html"},
+	}
+
+	for _, testCase := range cases {
+		fileName, err := expandDefaultName(testCase.name, testCase.url, now)
+		if err != nil || fileName != testCase.expected {
+			t.Errorf("Failed %s %s: %q, %v, expected %q \n", testCase.name, testCase.url, fileName, err, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadDefaultFileName(t *testing.T) {
+	content := bytes.Repeat([]byte("<html></html>\n"), 1000)
+
+	cases := []struct {
+		name         string
+		defaultName  string
+		acceptRanges bool
+		expected     string
+	}{
+		{"serial", "", false, "index.html"},
+		{"parallel", "", true, "index.html"},
+		{"serial custom", "{host}.html", false, "127.0.0.1.html"},
+		{"parallel custom", "{host}.html", true, "127.0.0.1.html"},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !testCase.acceptRanges {
+				_, _ = w.Write(content)
+
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/", Options{
+			ParallelRequests: 4,
+			DefaultFileName:  testCase.defaultName,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if result.FileName != filepath.Join(dir, testCase.expected) || result.Parallel != testCase.acceptRanges {
+			t.Errorf("Failed %s: %s, parallel %t \n", testCase.name, result.FileName, result.Parallel)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: downloaded %d bytes \n", testCase.name, len(data))
+		}
+	}
+}
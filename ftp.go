@@ -0,0 +1,312 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// ErrUnsupportedScheme is returned for URLs other than http, https and ftp.
+var ErrUnsupportedScheme = errors.New("unsupported URL scheme")
+
+const defaultFTPPort = "21"
+
+// checkScheme rejects URLs no download path handles.
+func checkScheme(downloadURL string) error {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+		return nil
+	}
+
+	return fmt.Errorf("%w %q", ErrUnsupportedScheme, u.Scheme)
+}
+
+func isFTPURL(downloadURL string) bool {
+	u, err := url.Parse(downloadURL)
+
+	return err == nil && strings.EqualFold(u.Scheme, "ftp")
+}
+
+// ftpFile is an FTP retrieval in progress. Closing it ends the transfer and
+// the control connection.
+type ftpFile struct {
+	conn *ftp.ServerConn
+	body *ftp.Response
+	stop func() bool
+
+	// size is the length reported by SIZE, or zero when unknown.
+	size uint64
+
+	// offset is where the transfer starts; it is zero when the server
+	// doesn't support REST.
+	offset uint64
+
+	// lastModified is the MDTM time in the Last-Modified format.
+	lastModified string
+}
+
+func (f *ftpFile) Read(data []byte) (int, error) {
+	return f.body.Read(data)
+}
+
+func (f *ftpFile) Close() error {
+	f.stop()
+
+	err := f.body.Close()
+	_ = f.conn.Quit()
+
+	return err
+}
+
+// openFTP logs in to the server of u and retrieves its file from offset. The
+// credentials come from the URL, Options.Username and Options.Password or
+// Options.Netrc, or default to an anonymous login.
+func openFTP(ctx context.Context, u *url.URL, opts Options, offset uint64) (*ftpFile, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultFTPPort)
+	}
+
+	// The control and the data connections are dialed like HTTP ones.
+	dial, err := newDialFunc(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ftp.Dial(host, ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		return dial(ctx, network, address)
+	}))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	user, password := "anonymous", "anonymous"
+
+	switch {
+	case u.User != nil:
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	case opts.Username != "":
+		user, password = opts.Username, opts.Password
+	default:
+		if login, ok := opts.Netrc.lookup(u.Hostname(), true); ok {
+			user, password = login.login, login.password
+		}
+	}
+
+	if err := conn.Login(user, password); err != nil {
+		_ = conn.Quit()
+
+		return nil, fmt.Errorf("ftp login as %q failed: %w", user, err)
+	}
+
+	filePath := strings.TrimPrefix(u.Path, "/")
+
+	file := &ftpFile{conn: conn}
+
+	// SIZE and MDTM are extensions; the file is downloaded all the same
+	// without them.
+	if size, err := conn.FileSize(filePath); err == nil && size > 0 {
+		file.size = uint64(size)
+	}
+
+	if conn.IsGetTimeSupported() {
+		if modTime, err := conn.GetTime(filePath); err == nil {
+			file.lastModified = modTime.UTC().Format(http.TimeFormat)
+		}
+	}
+
+	if file.size > 0 && offset >= file.size {
+		offset = 0
+	}
+
+	file.body, err = conn.RetrFrom(filePath, offset)
+	if err != nil && offset > 0 {
+		opts.logger().Info("ftp server can't resume, starting over", "url", u.Redacted(), "error", err)
+
+		offset = 0
+		file.body, err = conn.Retr(filePath)
+	}
+
+	if err != nil {
+		_ = conn.Quit()
+
+		return nil, contextError(ctx, err)
+	}
+
+	file.offset = offset
+
+	// Neither connection watches the context, so cancellation unblocks the
+	// transfer by expiring its deadline.
+	file.stop = context.AfterFunc(ctx, func() {
+		_ = file.body.SetDeadline(time.Unix(1, 0))
+	})
+
+	opts.logger().Debug("ftp transfer started", "url", u.Redacted(), "size", file.size, "offset", offset)
+
+	return file, nil
+}
+
+// ftpDownload retrieves an ftp:// URL into a file with a single transfer.
+// With Options.Continue a partial file is resumed using REST.
+func ftpDownload(ctx context.Context, downloadURL string, opts Options) (Result, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return Result{}, err
+	}
+
+	fileName, err := parseURLAndCaptureFilename(downloadURL)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if fileName == "" && opts.OutputPath == "" {
+		return Result{}, fmt.Errorf("ftp URL %q doesn't name a file", u.Redacted())
+	}
+
+	if opts.OutputPath == "" {
+		fileName, err = expandOutputTemplate(fileName, downloadURL, opts, time.Now())
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	fileName, err = preservedFilePath(downloadURL, fileName, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	fileName, err = targetFileName(fileName, opts)
+	if err != nil {
+		return Result{FileName: fileName}, err
+	}
+
+	partialFileName := partialFilePath(fileName, opts)
+
+	var offset uint64
+
+	if opts.Continue {
+		if info, err := os.Stat(partialFileName); err == nil {
+			offset = uint64(info.Size())
+		}
+	}
+
+	file, err := openFTP(ctx, u, opts, offset)
+	if err != nil {
+		return Result{}, err
+	}
+
+	offset = file.offset
+
+	if file.size > 0 {
+		if err := checkSize(partialFileName, file.size, file.size-offset, opts); err != nil {
+			_ = file.Close()
+
+			return Result{}, err
+		}
+	}
+
+	progress := newProgressWriter(opts, file.size)
+	progress.readBytes = offset
+
+	body := opts.limitReader(ctx, file)
+	if opts.MaxSize > 0 && !opts.Force {
+		body = &maxSizeReader{reader: body, max: opts.MaxSize, read: offset}
+	}
+
+	err = dataWriter(ctx, partialFileName, offset > 0, body, progress, opts.copyBufferSize())
+	progress.finish()
+
+	// The server confirms a complete transfer once the data connection is
+	// closed.
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	written := atomic.LoadUint64(&progress.readBytes)
+
+	if err == nil && file.size > 0 && written != file.size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrFileTooLarge) || !keepPartial(contextError(ctx, err), opts) {
+			_ = os.Remove(partialFileName)
+		}
+
+		return Result{}, contextError(ctx, err)
+	}
+
+	if file.size > 0 {
+		if err := verifyLength(partialFileName, file.size, opts); err != nil {
+			return Result{}, err
+		}
+	}
+
+	manifest := &Manifest{URL: u.Redacted(), LastModified: file.lastModified, Chunks: 1}
+
+	checksum, err := finishDownload(partialFileName, fileName, manifest, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return completedResult(fileName, downloadURL, written-offset, false, manifest, checksum), nil
+}
+
+// openFTPStream is the OpenStream counterpart of ftpDownload.
+func openFTPStream(ctx context.Context, downloadURL string, opts Options) (io.ReadCloser, int64, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	file, err := openFTP(ctx, u, opts, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := checkMaxSize(file.size, opts); err != nil {
+		_ = file.Close()
+
+		return nil, 0, err
+	}
+
+	size := int64(-1)
+	if file.size > 0 {
+		size = int64(file.size)
+	}
+
+	progress := newProgressWriter(opts, file.size)
+
+	var reader io.Reader = io.TeeReader(opts.limitReader(ctx, file), progress)
+
+	if opts.MaxSize > 0 && !opts.Force {
+		reader = &maxSizeReader{reader: reader, max: opts.MaxSize}
+	}
+
+	body := struct {
+		io.Reader
+		io.Closer
+	}{reader, closerFunc(func() error {
+		progress.finish()
+
+		return file.Close()
+	})}
+
+	return body, size, nil
+}
@@ -0,0 +1,239 @@
+package fastdownloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ftpModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// serveFTP runs a minimal passive mode FTP server offering files until the
+// test ends and returns its address. REST is refused unless rest is set.
+func serveFTP(t *testing.T, files map[string][]byte, rest bool) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveFTPConn(conn, files, rest)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveFTPConn(conn net.Conn, files map[string][]byte, rest bool) {
+	defer func() { _ = conn.Close() }()
+
+	reply := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var (
+		data   net.Listener
+		offset int
+	)
+
+	defer func() {
+		if data != nil {
+			_ = data.Close()
+		}
+	}()
+
+	reply("220 ready")
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command, arg, _ := strings.Cut(scanner.Text(), " ")
+		content, found := files[arg]
+
+		switch command {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			reply("230 logged in")
+		case "FEAT":
+			reply("211-Features:\r\n SIZE\r\n MDTM\r\n211 End")
+		case "TYPE":
+			reply("200 type set")
+		case "EPSV":
+			var err error
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 can't open data connection")
+
+				continue
+			}
+
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "SIZE":
+			if !found {
+				reply("550 not found")
+
+				continue
+			}
+
+			reply("213 %d", len(content))
+		case "MDTM":
+			reply("213 %s", ftpModTime.Format("20060102150405"))
+		case "REST":
+			if !rest {
+				reply("502 REST not implemented")
+
+				continue
+			}
+
+			offset, _ = strconv.Atoi(arg)
+			reply("350 restarting at %d", offset)
+		case "RETR":
+			if !found {
+				reply("550 not found")
+
+				continue
+			}
+
+			reply("150 sending")
+
+			dataConn, err := data.Accept()
+			if err != nil {
+				return
+			}
+
+			_, _ = dataConn.Write(content[offset:])
+			_ = dataConn.Close()
+			offset = 0
+
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	cases := []struct {
+		rest          bool
+		partial       int
+		expectedBytes uint64
+	}{
+		{true, 0, uint64(len(content))},
+		{true, 1000, uint64(len(content) - 1000)},
+		{false, 1000, uint64(len(content))},
+	}
+
+	for _, testCase := range cases {
+		addr := serveFTP(t, map[string][]byte{"pub/file.bin": content}, testCase.rest)
+
+		dir := t.TempDir()
+
+		if testCase.partial > 0 {
+			err := os.WriteFile(filepath.Join(dir, "file.bin"+partialFileSuffix), content[:testCase.partial], 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		result, err := Download(context.Background(), "ftp://"+addr+"/pub/file.bin", Options{
+			OutputDir:      dir,
+			Continue:       true,
+			ProgressOutput: io.Discard,
+		})
+		if err != nil {
+			t.Errorf("Failed %+v: %v \n", testCase, err)
+
+			continue
+		}
+
+		if result.Bytes != testCase.expectedBytes {
+			t.Errorf("Failed %+v: %d bytes transferred, expected %d \n", testCase, result.Bytes, testCase.expectedBytes)
+		}
+
+		data, err := os.ReadFile(result.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Failed %+v: %d bytes saved, expected %d \n", testCase, len(data), len(content))
+		}
+
+		if info, err := os.Stat(result.FileName); err != nil || !info.ModTime().Equal(ftpModTime) {
+			t.Errorf("Failed %+v: modification time not preserved \n", testCase)
+		}
+	}
+}
+
+func TestFTPOpenStream(t *testing.T) {
+	content := []byte("streamed over ftp")
+
+	addr := serveFTP(t, map[string][]byte{"file.txt": content}, false)
+
+	stream, size, err := OpenStream(context.Background(), "ftp://user:secret@"+addr+"/file.txt", Options{
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(stream)
+	if closeErr := stream.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) || size != int64(len(content)) {
+		t.Errorf("Failed %q (size %d) != %q \n", data, size, content)
+	}
+}
+
+func TestFTPDownloadMissingFile(t *testing.T) {
+	addr := serveFTP(t, nil, false)
+
+	_, err := Download(context.Background(), "ftp://"+addr+"/missing.bin", Options{
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if err == nil {
+		t.Errorf("Failed missing file downloaded \n")
+	}
+}
+
+func TestDownloadUnsupportedScheme(t *testing.T) {
+	_, err := Download(context.Background(), "gopher://example.com/file.txt", Options{
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Failed %v, expected ErrUnsupportedScheme \n", err)
+	}
+}
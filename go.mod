@@ -1,5 +1,15 @@
 module fastdownloader
 
-go 1.16
+go 1.21
 
-require github.com/jondot/goweight v1.0.5 // indirect
+require (
+	github.com/jlaffaye/ftp v0.2.0
+	golang.org/x/term v0.20.0
+)
+
+require (
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/jondot/goweight v1.0.5 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
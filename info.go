@@ -0,0 +1,122 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RemoteInfo is what a HEAD request reveals about a URL, like curl -I but
+// read the way Download reads it.
+type RemoteInfo struct {
+	// URL is where the HEAD request ended up after following redirects.
+	URL string
+
+	// Status is the status line of the response, e.g. "200 OK".
+	Status string
+
+	// ContentLength is the Content-Length of the HEAD response. KnownLength
+	// is false when the server left it out, and ContentLength is then zero.
+	ContentLength uint64
+	KnownLength   bool
+
+	// ContentType is the Content-Type header as sent, parameters included.
+	ContentType string
+
+	// AcceptRanges is the raw Accept-Ranges header, e.g. "bytes" or "none",
+	// unlike the bool in DownloadPlan. It is empty when the header is absent.
+	AcceptRanges string
+
+	// ETag and LastModified are the validators a resumed download checks
+	// the partial file against, or empty when the server sends none.
+	ETag         string
+	LastModified string
+
+	// FileName is the output path the response headers and opts lead to,
+	// taking Content-Disposition into account.
+	FileName string
+
+	// NoParallelReason tells why the response rules out a parallel download,
+	// or is zero when it allows one.
+	NoParallelReason NoParallelReason
+}
+
+// Info sends a single HEAD request for downloadURL and reports the response.
+// Unlike Plan it doesn't fall back to a ranged GET, so it shows what the
+// server answers HEAD with. Nothing is written to disk.
+func Info(ctx context.Context, downloadURL string, opts Options) (*RemoteInfo, error) {
+	opts, err := opts.prepare(downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if isFTPURL(downloadURL) {
+		return nil, errors.New("info only supports http and https URLs")
+	}
+
+	res, err := headRequest(ctx, opts, downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := newRemoteFile(res.Header, res.Request.URL.String(), opts)
+
+	fileName, err := resolveFileName(downloadURL, res.Header, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &RemoteInfo{
+		URL:           remote.resolvedURL,
+		Status:        res.Status,
+		ContentLength: remote.contentLength,
+		KnownLength:   remote.knownLength,
+		ContentType:   res.Header.Get("Content-Type"),
+		AcceptRanges:  res.Header.Get(acceptRangesHeader),
+		ETag:          remote.etag,
+		LastModified:  remote.lastModified,
+		FileName:      fileName,
+	}
+
+	if !remote.supportsParallel() {
+		info.NoParallelReason = remote.noParallelReason()
+	}
+
+	return info, nil
+}
+
+func (i *RemoteInfo) String() string {
+	var b strings.Builder
+
+	line := func(name, value string) {
+		if value == "" {
+			value = "-"
+		}
+
+		fmt.Fprintf(&b, "%-15s %s\n", name+":", value)
+	}
+
+	line("URL", i.URL)
+	line("Status", i.Status)
+
+	if i.KnownLength {
+		line("Content-Length", fmt.Sprintf("%s (%d bytes)", FormatBytes(float64(i.ContentLength), "B"), i.ContentLength))
+	} else {
+		line("Content-Length", "unknown")
+	}
+
+	line("Content-Type", i.ContentType)
+	line("Accept-Ranges", i.AcceptRanges)
+	line("ETag", i.ETag)
+	line("Last-Modified", i.LastModified)
+	line("File name", i.FileName)
+
+	if i.NoParallelReason != 0 {
+		line("Parallel", "no, "+i.NoParallelReason.String())
+	} else {
+		line("Parallel", "yes")
+	}
+
+	return b.String()
+}
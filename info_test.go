@@ -0,0 +1,74 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	modTime := time.Date(2024, time.May, 6, 7, 8, 9, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file.bin", http.StatusFound)
+	})
+	mux.HandleFunc("/file.bin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Failed unexpected %s request \n", r.Method)
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	info, err := Info(context.Background(), server.URL+"/latest", Options{OutputDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"URL:            " + server.URL + "/file.bin",
+		"Status:         200 OK",
+		"Content-Length: 1000.0 B (1000 bytes)",
+		"Content-Type:   application/octet-stream",
+		"Accept-Ranges:  bytes",
+		`ETag:           "v1"`,
+		"Last-Modified:  Mon, 06 May 2024 07:08:09 GMT",
+		"File name:      " + filepath.Join(dir, "latest"),
+		"Parallel:       yes",
+	}
+
+	if s := info.String(); s != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("Failed unexpected report:\n%s \n", s)
+	}
+
+	info, err = Info(context.Background(), server.URL+"/page", Options{OutputDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.NoParallelReason != ReasonNoAcceptRanges || !strings.Contains(info.String(), "Parallel:       no, ") {
+		t.Errorf("Failed parallel reported for %+v \n", info)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Failed info wrote %d files \n", len(entries))
+	}
+}
@@ -0,0 +1,161 @@
+package fastdownloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// manifestFileSuffix is appended to the file name for the manifest sidecar.
+const manifestFileSuffix = ".json"
+
+// Manifest describes a completed download. With Options.WriteManifest it is
+// saved next to the file as "<name>.json".
+type Manifest struct {
+	// URL is the download URL and Mirrors the further URLs chunks could be
+	// fetched from.
+	URL     string   `json:"url"`
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// Size is the size of the saved file and SHA256 its hex encoded digest.
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// ETag and LastModified are the server's headers for this version of the
+	// file.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	// Chunks is the number of byte ranges the file was downloaded in, one for
+	// a serial download.
+	Chunks int `json:"chunks"`
+
+	// Completed is when the download finished.
+	Completed time.Time `json:"completed"`
+}
+
+// ReadManifest reads the manifest sidecar of fileName.
+func ReadManifest(fileName string) (*Manifest, error) {
+	data, err := os.ReadFile(fileName + manifestFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func writeManifest(fileName string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName+manifestFileSuffix, append(data, '\n'), 0666)
+}
+
+// complete fills in the details of the finished partialFileName. The SHA-256
+// in sums, computed while verifying the file, or the digest of a sha256
+// Checksum the file was verified against is reused instead of hashing the
+// file again.
+func (m *Manifest) complete(partialFileName string, opts Options, sums map[string][]byte) error {
+	info, err := os.Stat(partialFileName)
+	if err != nil {
+		return err
+	}
+
+	m.Size = uint64(info.Size())
+	m.Completed = time.Now().UTC()
+
+	if sum, ok := sums["sha256"]; ok {
+		m.SHA256 = hex.EncodeToString(sum)
+
+		return nil
+	}
+
+	if opts.checksum != nil && opts.checksum.algorithm == "sha256" {
+		m.SHA256 = hex.EncodeToString(opts.checksum.expected)
+
+		return nil
+	}
+
+	h := sha256.New()
+	if err := hashFile(partialFileName, h); err != nil {
+		return err
+	}
+
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
+
+// upToDate reports whether the manifest of fileName shows it is a complete
+// download of the remote version described by current, so downloading it
+// again can be skipped. The version matches when the ETag, or Last-Modified
+// for servers without ETags, and the size agree. A Checksum is compared with
+// the recorded SHA-256 when possible and verified against the file otherwise.
+// With Newer, a file at least as recent as the remote one is up to date too.
+func upToDate(fileName string, current *Manifest, knownSize bool, opts Options) bool {
+	if opts.Overwrite {
+		return false
+	}
+
+	if opts.Newer && !remoteNewer(fileName, current.LastModified, opts) {
+		opts.logger().Info("file is up to date", "file", fileName, "lastModified", current.LastModified)
+
+		return true
+	}
+
+	if !opts.WriteManifest {
+		return false
+	}
+
+	saved, err := ReadManifest(fileName)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case current.ETag != "":
+		if saved.ETag != current.ETag {
+			return false
+		}
+	case current.LastModified != "":
+		if saved.LastModified != current.LastModified {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if knownSize && saved.Size != current.Size {
+		return false
+	}
+
+	if info, err := os.Stat(fileName); err != nil || uint64(info.Size()) != saved.Size {
+		return false
+	}
+
+	if c := opts.checksum; c != nil {
+		if c.algorithm == "sha256" {
+			if saved.SHA256 != hex.EncodeToString(c.expected) {
+				return false
+			}
+		} else {
+			h := c.newHash()
+			if hashFile(fileName, h) != nil || c.verify(h) != nil {
+				return false
+			}
+		}
+	}
+
+	opts.logger().Info("file is up to date", "file", fileName, "manifest", fileName+manifestFileSuffix)
+
+	return true
+}
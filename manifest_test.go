@@ -0,0 +1,208 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"  //nolint:gosec
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+
+	manifest := &Manifest{
+		URL:          "https://example.com/file.bin",
+		Mirrors:      []string{"https://mirror.example.com/file.bin"},
+		Size:         1234,
+		SHA256:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		ETag:         `"v1"`,
+		LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
+		Chunks:       4,
+		Completed:    time.Date(2024, time.May, 6, 7, 8, 9, 0, time.UTC),
+	}
+
+	if err := writeManifest(fileName, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadManifest(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, manifest) {
+		t.Errorf("Failed %+v != %+v \n", read, manifest)
+	}
+}
+
+func TestDownloadWritesManifest(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+
+	cases := []struct {
+		acceptRanges bool
+		chunks       int
+	}{
+		{true, 4},
+		{false, 1},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:         4,
+			WriteManifest:  true,
+			OutputDir:      t.TempDir(),
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %+v: %v \n", testCase, err)
+		}
+
+		manifest, err := ReadManifest(result.FileName)
+		if err != nil {
+			t.Fatalf("Failed %+v: %v \n", testCase, err)
+		}
+
+		if manifest.URL != server.URL+"/file.bin" || manifest.Size != uint64(len(content)) ||
+			manifest.SHA256 != hex.EncodeToString(sum[:]) || manifest.ETag != `"v1"` ||
+			manifest.Chunks != testCase.chunks || manifest.Completed.IsZero() {
+			t.Errorf("Failed %+v: manifest %+v \n", testCase, manifest)
+		}
+	}
+}
+
+func TestDownloadVerifiesAndWritesManifestInOnePass(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	md5Sum := md5.Sum(content)   //nolint:gosec
+	sha1Sum := sha1.Sum(content) //nolint:gosec
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(digestHeader, "SHA="+base64.StdEncoding.EncodeToString(sha1Sum[:]))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		Chunks:         4,
+		Checksum:       "md5:" + hex.EncodeToString(md5Sum[:]),
+		WriteManifest:  true,
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	saved, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manifest's SHA-256, computed while verifying the checksum and the
+	// digest, matches an independent hash of the saved file.
+	expected := sha256.Sum256(saved)
+
+	manifest, err := ReadManifest(result.FileName)
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	if manifest.SHA256 != hex.EncodeToString(expected[:]) || !bytes.Equal(saved, content) {
+		t.Errorf("Failed manifest SHA-256 %s, expected %x \n", manifest.SHA256, expected)
+	}
+}
+
+func TestDownloadSkipsUpToDateFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+
+	var (
+		etag atomic.Value
+		gets atomic.Int64
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-0" {
+			gets.Add(1)
+		}
+
+		w.Header().Set("ETag", etag.Load().(string))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	download := func(checksum string) (Result, error) {
+		gets.Store(0)
+
+		return Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:         4,
+			Checksum:       checksum,
+			WriteManifest:  true,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+	}
+
+	etag.Store(`"v1"`)
+
+	if _, err := download(""); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		etag     string
+		checksum string
+		skipped  bool
+	}{
+		{`"v1"`, "", true},
+		{`"v1"`, "sha256:" + hex.EncodeToString(sum[:]), true},
+		{`"v1"`, "sha256:" + hex.EncodeToString(make([]byte, sha256.Size)), false},
+		{`"v2"`, "", false},
+	}
+
+	for _, testCase := range cases {
+		etag.Store(testCase.etag)
+
+		result, err := download(testCase.checksum)
+
+		if testCase.skipped && (err != nil || !result.Skipped || gets.Load() != 0) {
+			t.Errorf("Failed %+v: %v, skipped %t after %d requests \n", testCase, err, result.Skipped, gets.Load())
+		}
+
+		// A file that isn't up to date is treated like any existing file.
+		if !testCase.skipped && !errors.Is(err, ErrFileExists) {
+			t.Errorf("Failed %+v: %v, expected ErrFileExists \n", testCase, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrMirrorMismatch is returned when a mirror announces a different size than
+// the other sources of a download, so it can't be serving the same file.
+var ErrMirrorMismatch = errors.New("mirror doesn't match the download")
+
+// mirror is a URL a parallel download fetches chunks from, together with the
+// validator its range requests send as If-Range. Validators are per mirror,
+// since two servers rarely agree on ETags.
+type mirror struct {
+	url           string
+	validator     string
+	contentLength uint64
+}
+
+func newMirror(remote *remoteFile) mirror {
+	return mirror{url: remote.resolvedURL, validator: remote.validator, contentLength: remote.contentLength}
+}
+
+// probeMirrors returns the sources of a parallel download of remote: remote
+// itself when it supports byte ranges, followed by every Options.Mirrors
+// entry that does too. Unreachable mirrors and mirrors without range support
+// are skipped, but one announcing a different size fails the download. It
+// returns no mirrors when none supports a parallel download.
+func probeMirrors(ctx context.Context, remote *remoteFile, opts Options) ([]mirror, error) {
+	var mirrors []mirror
+
+	if remote.supportsParallel() {
+		mirrors = append(mirrors, newMirror(remote))
+	}
+
+	for _, mirrorURL := range opts.Mirrors {
+		mirrorRemote, err := probeRanges(ctx, mirrorURL, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, contextError(ctx, err)
+			}
+
+			opts.logger().Info("skipping mirror", "url", mirrorURL, "error", err)
+
+			continue
+		}
+
+		if !mirrorRemote.supportsParallel() {
+			opts.logger().Info("skipping mirror", "url", mirrorURL, "reason", mirrorRemote.noParallelReason())
+
+			continue
+		}
+
+		if len(mirrors) > 0 && mirrorRemote.contentLength != mirrors[0].contentLength {
+			return nil, fmt.Errorf("%w: %s has %d bytes, %s has %d",
+				ErrMirrorMismatch, mirrorURL, mirrorRemote.contentLength, mirrors[0].url, mirrors[0].contentLength)
+		}
+
+		mirrors = append(mirrors, newMirror(mirrorRemote))
+	}
+
+	return mirrors, nil
+}
+
+// mirrorPool schedules the chunk requests of a download across its mirrors,
+// so they are fetched from all of them at the same time. A request goes to
+// the mirror expected to serve it soonest given its measured speed and the
+// requests it is already serving, so the first chunks are spread round-robin
+// and slow or failing mirrors get fewer chunks from then on.
+type mirrorPool struct {
+	mu      sync.Mutex
+	mirrors []mirror
+	stats   []mirrorStats
+	next    int
+}
+
+type mirrorStats struct {
+	active   int
+	chunks   int
+	failures int
+	bytes    uint64
+	elapsed  time.Duration
+}
+
+func newMirrorPool(mirrors []mirror) *mirrorPool {
+	return &mirrorPool{mirrors: mirrors, stats: make([]mirrorStats, len(mirrors))}
+}
+
+// acquire picks the mirror for the next request of a chunk. Mirrors the chunk
+// already tried are only picked again once it tried all of them.
+func (p *mirrorPool) acquire(tried []bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	untried := false
+
+	for i := range p.mirrors {
+		if !tried[i] {
+			untried = true
+		}
+	}
+
+	// Mirrors without a measurement yet are assumed to be as fast as the
+	// average of the others.
+	var (
+		measuredSpeed float64
+		measured      int
+	)
+
+	for _, stats := range p.stats {
+		if stats.elapsed > 0 {
+			measuredSpeed += stats.speed()
+			measured++
+		}
+	}
+
+	defaultSpeed := 1.0
+	if measured > 0 && measuredSpeed > 0 {
+		defaultSpeed = measuredSpeed / float64(measured)
+	}
+
+	best, bestCost := -1, 0.0
+
+	for k := range p.mirrors {
+		i := (p.next + k) % len(p.mirrors)
+		if untried && tried[i] {
+			continue
+		}
+
+		speed := defaultSpeed
+		if p.stats[i].elapsed > 0 {
+			speed = p.stats[i].speed()
+		}
+
+		cost := float64(p.stats[i].active+1) * float64(p.stats[i].failures+1) / speed
+		if best == -1 || cost < bestCost {
+			best, bestCost = i, cost
+		}
+	}
+
+	p.next = (best + 1) % len(p.mirrors)
+	p.stats[best].active++
+
+	return best
+}
+
+// release records a request to mirror i that transferred n bytes in elapsed.
+func (p *mirrorPool) release(i int, n uint64, elapsed time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := &p.stats[i]
+	stats.active--
+	stats.bytes += n
+	stats.elapsed += elapsed
+
+	if failed {
+		stats.failures++
+	} else {
+		stats.chunks++
+	}
+}
+
+// logStats logs how much every mirror contributed.
+func (p *mirrorPool) logStats(logger *slog.Logger) {
+	if len(p.mirrors) < 2 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, stats := range p.stats {
+		logger.Info("mirror finished", "url", p.mirrors[i].url, "chunks", stats.chunks,
+			"failures", stats.failures, "bytes", stats.bytes, "speed", FormatBytes(stats.speed(), "B/s"))
+	}
+}
+
+// speed is the average transfer rate in bytes per second, or a tiny rate for
+// a mirror that hasn't delivered anything, so it is only used as a last resort.
+func (s mirrorStats) speed() float64 {
+	if s.bytes == 0 || s.elapsed <= 0 {
+		return 1e-9
+	}
+
+	return float64(s.bytes) / s.elapsed.Seconds()
+}
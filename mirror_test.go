@@ -0,0 +1,209 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadFailsOverToMirror(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// The download URL announces range support but fails every chunk.
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer primary.Close()
+
+	var mirrorRanges atomic.Int64
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			mirrorRanges.Add(1)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer mirror.Close()
+
+	result, err := Download(context.Background(), primary.URL+"/file.bin", Options{
+		Chunks:         4,
+		Mirrors:        []string{mirror.URL + "/file.bin"},
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(content))
+	}
+
+	if mirrorRanges.Load() != 4 {
+		t.Errorf("Failed %d chunks fetched from the mirror, expected 4 \n", mirrorRanges.Load())
+	}
+}
+
+func TestDownloadUsesMirrorWithRanges(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	// The download URL doesn't support ranges, so only the mirror can
+	// deliver chunks.
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer primary.Close()
+
+	var mirrorRanges atomic.Int64
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			mirrorRanges.Add(1)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer mirror.Close()
+
+	result, err := Download(context.Background(), primary.URL+"/file.bin", Options{
+		Chunks:         4,
+		Mirrors:        []string{"http://127.0.0.1:1/unreachable.bin", mirror.URL + "/file.bin"},
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(content))
+	}
+
+	if mirrorRanges.Load() < 4 {
+		t.Errorf("Failed %d range requests to the mirror, expected 4 chunks \n", mirrorRanges.Load())
+	}
+}
+
+func TestDownloadRejectsMismatchedMirror(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer primary.Close()
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content[1:]))
+	}))
+	defer mirror.Close()
+
+	dir := t.TempDir()
+
+	_, err := Download(context.Background(), primary.URL+"/file.bin", Options{
+		Mirrors:        []string{mirror.URL + "/file.bin"},
+		OutputDir:      dir,
+		ProgressOutput: io.Discard,
+	})
+	if !errors.Is(err, ErrMirrorMismatch) {
+		t.Errorf("Failed %v, expected ErrMirrorMismatch \n", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Failed %d files written \n", len(entries))
+	}
+}
+
+func TestMirrorPool(t *testing.T) {
+	pool := newMirrorPool(make([]mirror, 3))
+	none := make([]bool, 3)
+
+	// Without measurements the requests are spread round-robin.
+	for expected := 0; expected < 6; expected++ {
+		if i := pool.acquire(none); i != expected%3 {
+			t.Errorf("Failed request %d went to mirror %d \n", expected, i)
+		}
+	}
+
+	// Mirror 1 is almost ten times faster than mirror 0, mirror 2 failed.
+	pool.stats[0] = mirrorStats{bytes: 1000, elapsed: time.Second}
+	pool.stats[1] = mirrorStats{bytes: 9500, elapsed: time.Second}
+	pool.stats[2] = mirrorStats{failures: 1, elapsed: time.Second}
+
+	var counts [3]int
+
+	for n := 0; n < 11; n++ {
+		counts[pool.acquire(none)]++
+	}
+
+	if counts != [3]int{1, 10, 0} {
+		t.Errorf("Failed requests per mirror %v, expected [1 10 0] \n", counts)
+	}
+
+	// A chunk retries on mirrors it didn't try yet.
+	if i := pool.acquire([]bool{false, true, false}); i != 0 {
+		t.Errorf("Failed retry went to mirror %d, expected 0 \n", i)
+	}
+}
+
+func TestDownloadSpreadsChunksAcrossMirrors(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	newServer := func(delay time.Duration, ranges *atomic.Int64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+				ranges.Add(1)
+				time.Sleep(delay)
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+	}
+
+	var fastRanges, slowRanges atomic.Int64
+
+	fast := newServer(0, &fastRanges)
+	defer fast.Close()
+
+	slow := newServer(50*time.Millisecond, &slowRanges)
+	defer slow.Close()
+
+	result, err := Download(context.Background(), fast.URL+"/file.bin", Options{
+		ParallelRequests: 2,
+		ChunkStrategy:    FixedSizeChunks{Size: 1024},
+		Mirrors:          []string{slow.URL + "/file.bin"},
+		OutputDir:        t.TempDir(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes saved, expected %d \n", len(data), len(content))
+	}
+
+	// Both mirrors serve chunks at the same time, but the slow one only a
+	// few of the 64.
+	if slowRanges.Load() == 0 || slowRanges.Load() > 8 {
+		t.Errorf("Failed %d chunks from the slow mirror, %d from the fast one \n", slowRanges.Load(), fastRanges.Load())
+	}
+}
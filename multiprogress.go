@@ -0,0 +1,213 @@
+package fastdownloader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultiProgress renders the progress of several concurrent downloads on one
+// writer, which it owns while they run. On a terminal it redraws a block with
+// a line per active download and a line with their total in place, moving the
+// cursor with ANSI escapes. Other writers get those lines every 5 seconds
+// instead. It is safe for concurrent use.
+type MultiProgress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	now   func() time.Time
+	width func() int
+
+	started time.Time
+	active  []*multiProgressEntry
+
+	// finished and finishedFiles count the downloads already removed.
+	finished      uint64
+	finishedFiles int
+
+	// drawn is the number of lines of the block on the terminal.
+	drawn    int
+	lastDraw time.Time
+}
+
+type multiProgressEntry struct {
+	name       string
+	downloaded uint64
+	total      uint64
+	started    time.Time
+}
+
+// NewMultiProgress returns a MultiProgress writing to w.
+func NewMultiProgress(w io.Writer) *MultiProgress {
+	return newMultiProgress(w, time.Now, terminalWidth(w))
+}
+
+func newMultiProgress(w io.Writer, now func() time.Time, width func() int) *MultiProgress {
+	return &MultiProgress{w: w, now: now, width: width, started: now()}
+}
+
+// Add shows a line for the download called name. The returned progress
+// function is meant for Options.ProgressFunc; done removes the line once the
+// download is over, and its bytes stay in the total.
+func (m *MultiProgress) Add(name string) (progress func(downloaded, total uint64), done func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &multiProgressEntry{name: name, started: m.now()}
+	m.active = append(m.active, entry)
+
+	progress = func(downloaded, total uint64) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		entry.downloaded, entry.total = downloaded, total
+
+		m.update(false)
+	}
+
+	done = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for i, e := range m.active {
+			if e == entry {
+				m.active = append(m.active[:i], m.active[i+1:]...)
+				m.finished += entry.downloaded
+				m.finishedFiles++
+
+				m.update(true)
+
+				return
+			}
+		}
+	}
+
+	return progress, done
+}
+
+// Println prints a line above the progress block, e.g. the result of a
+// download. Writing to the writer directly would garble the block.
+func (m *MultiProgress) Println(a ...any) {
+	m.Fprintln(m.w, a...)
+}
+
+// Fprintln prints a line to w above the progress block, for writers that may
+// share the terminal with it, like stdout.
+func (m *MultiProgress) Fprintln(w io.Writer, a ...any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.width == nil {
+		fmt.Fprintln(w, a...)
+
+		return
+	}
+
+	m.clear()
+	fmt.Fprintln(w, a...)
+	m.update(true)
+}
+
+// update redraws the block on a terminal, at most once per ProgressInterval
+// unless force is set, or prints its lines every progressLineInterval
+// elsewhere.
+func (m *MultiProgress) update(force bool) {
+	now := m.now()
+
+	if m.width == nil {
+		if !m.lastDraw.IsZero() && now.Sub(m.lastDraw) < progressLineInterval {
+			return
+		}
+
+		m.lastDraw = now
+
+		for _, line := range m.lines(now) {
+			fmt.Fprintln(m.w, line)
+		}
+
+		return
+	}
+
+	if !force && !m.lastDraw.IsZero() && now.Sub(m.lastDraw) < ProgressInterval {
+		return
+	}
+
+	m.lastDraw = now
+
+	var b strings.Builder
+
+	if m.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", m.drawn)
+	}
+
+	lines := m.lines(now)
+
+	for _, line := range lines {
+		b.WriteString("\r" + line + "\n")
+	}
+
+	// Lines of downloads removed since the last draw are left below.
+	b.WriteString("\x1b[J")
+
+	m.drawn = len(lines)
+
+	_, _ = io.WriteString(m.w, b.String())
+}
+
+// clear erases the block, leaving the cursor where it started.
+func (m *MultiProgress) clear() {
+	if m.drawn > 0 {
+		fmt.Fprintf(m.w, "\x1b[%dA\r\x1b[J", m.drawn)
+	}
+
+	m.drawn = 0
+}
+
+// lines formats a line per active download and one with their total.
+func (m *MultiProgress) lines(now time.Time) []string {
+	var (
+		lines      []string
+		downloaded = m.finished
+		total      = m.finished
+		unknown    bool
+	)
+
+	for _, e := range m.active {
+		status := progressStatus(e.name, e.downloaded, e.total, averageRate(e.downloaded, now.Sub(e.started)))
+		lines = append(lines, m.fit(status, e.downloaded, e.total))
+
+		downloaded += e.downloaded
+		total += e.total
+		unknown = unknown || e.total == 0
+	}
+
+	// A download of unknown length makes the total unknown too.
+	if unknown {
+		total = 0
+	}
+
+	label := fmt.Sprintf("Total (%d active, %d done)", len(m.active), m.finishedFiles)
+	status := progressStatus(label, downloaded, total, averageRate(downloaded, now.Sub(m.started)))
+
+	lines = append(lines, m.fit(status, downloaded, total))
+
+	return lines
+}
+
+func (m *MultiProgress) fit(status string, downloaded, total uint64) string {
+	if m.width == nil {
+		return status
+	}
+
+	return fitProgressLine(status, downloaded, total, m.width())
+}
+
+// averageRate is the speed of n bytes transferred over elapsed.
+func averageRate(n uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(n) / elapsed.Seconds()
+}
@@ -0,0 +1,108 @@
+package fastdownloader
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiProgressTerminal(t *testing.T) {
+	var (
+		output strings.Builder
+		clock  = time.Unix(0, 0)
+	)
+
+	multi := newMultiProgress(&output, func() time.Time { return clock }, func() int { return 100 })
+
+	reportA, doneA := multi.Add("a.bin")
+	reportB, _ := multi.Add("b.bin")
+
+	clock = clock.Add(time.Second)
+	reportA(1<<20, 2<<20)
+
+	// Reports within ProgressInterval of the last draw are dropped.
+	reportB(1<<20, 4<<20)
+
+	if strings.Contains(output.String(), "b.bin [1.0 Mi") {
+		t.Errorf("Failed throttled report drawn: %q \n", output.String())
+	}
+
+	clock = clock.Add(time.Second)
+	reportB(2<<20, 4<<20)
+
+	draws := strings.Split(output.String(), "\x1b[J")
+	last := draws[len(draws)-2]
+
+	if !strings.HasPrefix(last, "\x1b[3A\r") {
+		t.Errorf("Failed block not redrawn in place: %q \n", last)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(last, "\x1b[3A"), "\n"), "\n")
+
+	expected := []string{
+		"\ra.bin [1.0 Mi/2.0 Mi] (50%)",
+		"\rb.bin [2.0 Mi/4.0 Mi] (50%)",
+		"\rTotal (2 active, 0 done) [3.0 Mi/6.0 Mi] (50%)",
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Failed %q \n", last)
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) || len(line) != 100 {
+			t.Errorf("Failed line %d: %q doesn't start with %q or isn't fitted \n", i, line, expected[i])
+		}
+	}
+
+	doneA()
+	output.Reset()
+
+	multi.Println("Downloaded a.bin")
+
+	if !strings.HasPrefix(output.String(), "\x1b[2A\r\x1b[JDownloaded a.bin\n\rb.bin") {
+		t.Errorf("Failed line not printed above the block: %q \n", output.String())
+	}
+
+	if !strings.Contains(output.String(), "Total (1 active, 1 done) [3.0 Mi/5.0 Mi]") {
+		t.Errorf("Failed finished download left the total: %q \n", output.String())
+	}
+}
+
+func TestMultiProgressLines(t *testing.T) {
+	var (
+		output strings.Builder
+		clock  = time.Unix(0, 0)
+	)
+
+	multi := newMultiProgress(&output, func() time.Time { return clock }, nil)
+
+	reportA, _ := multi.Add("a.bin")
+	reportB, _ := multi.Add("b.bin")
+
+	for i := uint64(0); i <= 5; i++ {
+		reportA(i<<20, 10<<20)
+		reportB(i<<20, 0)
+		clock = clock.Add(time.Second)
+	}
+
+	expected := []string{
+		"a.bin [0.0 /10.0 Mi] (0%)",
+		"b.bin [0.0 ]",
+		"Total (2 active, 0 done) [0.0 ]",
+		"a.bin [5.0 Mi/10.0 Mi] (50%)",
+		"b.bin [4.0 Mi]",
+		"Total (2 active, 0 done) [9.0 Mi]",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Failed %q \n", output.String())
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("Failed line %d: %q doesn't start with %q \n", i, line, expected[i])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package fastdownloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Netrc holds the credentials of a .netrc file, as used by curl, wget and ftp.
+type Netrc struct {
+	machines map[string]netrcLogin
+
+	// fallback is the login of the default entry, if any.
+	fallback *netrcLogin
+}
+
+type netrcLogin struct {
+	login, password string
+}
+
+// ParseNetrc reads the "machine host login name password secret" entries of
+// a .netrc file, which may span several lines, and the "default" entry that
+// applies to every other host. Account fields and macdef macros are skipped,
+// as are lines starting with #. The first entry of a machine wins.
+func ParseNetrc(r io.Reader) (*Netrc, error) {
+	netrc := &Netrc{machines: map[string]netrcLogin{}}
+
+	var (
+		host  string
+		entry *netrcLogin
+
+		// keyword is the token waiting for its value.
+		keyword string
+
+		// macro is set from a macdef up to the next empty line.
+		macro bool
+	)
+
+	// add stores the entry that was read so far.
+	add := func() {
+		switch {
+		case entry == nil:
+		case host == "":
+			if netrc.fallback == nil {
+				netrc.fallback = entry
+			}
+		default:
+			if _, ok := netrc.machines[host]; !ok {
+				netrc.machines[host] = *entry
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+
+		if macro {
+			macro = strings.TrimSpace(line) != ""
+
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		for _, token := range strings.Fields(line) {
+			switch keyword {
+			case "":
+			case "machine":
+				host, keyword = strings.ToLower(token), ""
+
+				continue
+			case "login":
+				entry.login, keyword = token, ""
+
+				continue
+			case "password":
+				entry.password, keyword = token, ""
+
+				continue
+			case "account":
+				keyword = ""
+
+				continue
+			case "macdef":
+				// The rest of the line after the macro's name is its body.
+				macro, keyword = true, ""
+			}
+
+			if macro {
+				break
+			}
+
+			switch token {
+			case "machine", "default":
+				add()
+
+				host, entry = "", &netrcLogin{}
+
+				if token == "machine" {
+					keyword = token
+				}
+			case "login", "password", "account":
+				if entry == nil {
+					return nil, fmt.Errorf("netrc line %d: %s outside of a machine entry", lineNumber, token)
+				}
+
+				keyword = token
+			case "macdef":
+				keyword = token
+			default:
+				return nil, fmt.Errorf("netrc line %d: unexpected %q", lineNumber, token)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if keyword != "" {
+		return nil, fmt.Errorf("netrc: %s without a value", keyword)
+	}
+
+	add()
+
+	return netrc, nil
+}
+
+// lookup returns the credentials of host, a host name without a port. The
+// default entry applies only when withDefault is set.
+func (n *Netrc) lookup(host string, withDefault bool) (netrcLogin, bool) {
+	if n == nil {
+		return netrcLogin{}, false
+	}
+
+	if login, ok := n.machines[strings.ToLower(host)]; ok {
+		return login, true
+	}
+
+	if withDefault && n.fallback != nil {
+		return *n.fallback, true
+	}
+
+	return netrcLogin{}, false
+}
@@ -0,0 +1,159 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc, err := ParseNetrc(strings.NewReader(`# credentials
+machine example.com login alice password secret1
+machine Files.Example.org
+	login bob
+	account ignored
+	password secret2
+
+macdef init
+cd /pub
+machine macro.example.com login eve password nope
+
+default login anonymous password guest@
+machine example.com login mallory password shadowed
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		host        string
+		withDefault bool
+		expected    netrcLogin
+		found       bool
+	}{
+		{"example.com", false, netrcLogin{"alice", "secret1"}, true},
+		{"files.example.org", false, netrcLogin{"bob", "secret2"}, true},
+		// Machine lines in a macro aren't entries.
+		{"macro.example.com", false, netrcLogin{}, false},
+		{"other.example.com", false, netrcLogin{}, false},
+		{"other.example.com", true, netrcLogin{"anonymous", "guest@"}, true},
+	}
+
+	for _, testCase := range cases {
+		login, found := netrc.lookup(testCase.host, testCase.withDefault)
+		if found != testCase.found || login != testCase.expected {
+			t.Errorf("Failed %s: %+v, %t, expected %+v \n", testCase.host, login, found, testCase.expected)
+		}
+	}
+
+	for _, invalid := range []string{
+		"machine example.com login",
+		"login alice password secret",
+		"machine example.com user alice",
+	} {
+		if _, err := ParseNetrc(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Failed %q was accepted \n", invalid)
+		}
+	}
+}
+
+func TestNetrcAuthorization(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+
+	cases := []struct {
+		name             string
+		netrc            string
+		opts             Options
+		expectedOrigin   string
+		expectedRedirect string
+	}{
+		{"machine", "machine 127.0.0.1 login alice password secret", Options{}, basic("alice", "secret"), ""},
+		// The default entry doesn't follow a redirect to another host, an
+		// entry of that host does.
+		{"default", "default login guest password guest", Options{}, basic("guest", "guest"), ""},
+		{
+			"redirect machine",
+			"machine localhost login bob password other\ndefault login guest password guest",
+			Options{},
+			basic("guest", "guest"),
+			basic("bob", "other"),
+		},
+		// Explicit credentials win.
+		{"explicit", "machine 127.0.0.1 login alice password secret", Options{Username: "user", Password: "pass"}, basic("user", "pass"), ""},
+		{"header", "default login guest password guest", Options{Header: http.Header{"Authorization": {"Custom secret"}}}, "Custom secret", ""},
+	}
+
+	for _, testCase := range cases {
+		var (
+			mutex          sync.Mutex
+			originAuth     []string
+			redirectedAuth []string
+		)
+
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			redirectedAuth = append(redirectedAuth, r.Header.Get("Authorization"))
+			mutex.Unlock()
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		// The redirect goes to localhost, another host name than the
+		// origin's 127.0.0.1.
+		targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1) + "/file.bin"
+
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			originAuth = append(originAuth, r.Header.Get("Authorization"))
+			mutex.Unlock()
+
+			http.Redirect(w, r, targetURL, http.StatusFound)
+		}))
+
+		netrc, err := ParseNetrc(strings.NewReader(testCase.netrc))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := testCase.opts
+		opts.Netrc = netrc
+		opts.OutputDir = t.TempDir()
+		opts.ProgressOutput = io.Discard
+
+		_, err = Download(context.Background(), origin.URL+"/file.bin", opts)
+
+		origin.Close()
+		target.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		for _, auth := range originAuth {
+			if auth != testCase.expectedOrigin {
+				t.Errorf("Failed %s: origin got %q, expected %q \n", testCase.name, auth, testCase.expectedOrigin)
+			}
+		}
+
+		if len(redirectedAuth) == 0 {
+			t.Errorf("Failed %s: redirect target never reached \n", testCase.name)
+		}
+
+		for _, auth := range redirectedAuth {
+			if auth != testCase.expectedRedirect {
+				t.Errorf("Failed %s: redirect target got %q, expected %q \n", testCase.name, auth, testCase.expectedRedirect)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Range is an inclusive byte range.
+type Range struct {
+	Start uint64
+	Stop  uint64
+}
+
+// DownloadPlan describes what Download would do for a URL, as determined by
+// the HEAD probe alone.
+type DownloadPlan struct {
+	// URL is the download URL after following redirects.
+	URL string
+
+	// FileName is the path the download would be saved to.
+	FileName string
+
+	// ContentLength is the size announced by the server, if KnownLength.
+	ContentLength uint64
+	KnownLength   bool
+
+	// AcceptRanges reports whether the server advertises byte ranges.
+	AcceptRanges bool
+
+	// Encoded reports whether the server applies a Content-Encoding, which
+	// rules out a parallel download.
+	Encoded bool
+
+	// Chunks are the ranges of a parallel download. It is empty when the
+	// download would fall back to a single request.
+	Chunks []Range
+}
+
+// Plan probes downloadURL and returns the download plan without writing
+// anything to disk.
+func Plan(ctx context.Context, downloadURL string, opts Options) (*DownloadPlan, error) {
+	opts, err := opts.prepare(downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if isFTPURL(downloadURL) {
+		return nil, errors.New("dry runs only support http and https URLs")
+	}
+
+	remote, err := probeRemoteFile(ctx, downloadURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DownloadPlan{
+		URL:           remote.resolvedURL,
+		FileName:      remote.fileName,
+		ContentLength: remote.contentLength,
+		KnownLength:   remote.knownLength,
+		AcceptRanges:  remote.acceptRanges,
+		Encoded:       remote.encoded,
+	}
+
+	if remote.supportsParallel() {
+		for _, c := range planChunks(remote.contentLength, opts.chunkStrategy()) {
+			plan.Chunks = append(plan.Chunks, Range{Start: c.Start, Stop: c.Stop})
+		}
+	}
+
+	return plan, nil
+}
+
+func (p *DownloadPlan) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "URL: %s\n", p.URL)
+	fmt.Fprintf(&b, "File name: %s\n", p.FileName)
+
+	if p.KnownLength {
+		fmt.Fprintf(&b, "Content length: %s (%d bytes)\n", FormatBytes(float64(p.ContentLength), "B"), p.ContentLength)
+	} else {
+		fmt.Fprintf(&b, "Content length: unknown\n")
+	}
+
+	fmt.Fprintf(&b, "Accept-Ranges bytes: %t\n", p.AcceptRanges)
+
+	if p.Encoded {
+		fmt.Fprintf(&b, "Content encoded: true\n")
+	}
+
+	if len(p.Chunks) == 0 {
+		fmt.Fprintf(&b, "Mode: serial (parallel download not supported)\n")
+
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "Mode: parallel, %d chunks\n", len(p.Chunks))
+
+	for i, c := range p.Chunks {
+		fmt.Fprintf(&b, "  chunk %d: bytes %d-%d (%s)\n", i, c.Start, c.Stop, FormatBytes(float64(c.Stop-c.Start+1), "B"))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Failed unexpected %s request \n", r.Method)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	plan, err := Plan(context.Background(), server.URL+"/file.bin", Options{
+		Chunks:     3,
+		OutputDir:  dir,
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Range{{0, 333}, {334, 666}, {667, 999}}
+
+	if !plan.AcceptRanges || !plan.KnownLength || plan.ContentLength != 1000 || len(plan.Chunks) != len(expected) {
+		t.Fatalf("Failed unexpected plan %+v \n", plan)
+	}
+
+	for i, c := range plan.Chunks {
+		if c != expected[i] {
+			t.Errorf("Failed chunk %d: %+v != %+v \n", i, c, expected[i])
+		}
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Failed plan wrote %d files \n", len(entries))
+	}
+}
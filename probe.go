@@ -0,0 +1,273 @@
+package fastdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentRangeHeader = "Content-Range"
+	acceptRangesHeader = "Accept-Ranges"
+)
+
+// remoteFile is what probing a URL reveals about a download.
+type remoteFile struct {
+	resolvedURL   string
+	header        http.Header
+	fileName      string
+	contentLength uint64
+	knownLength   bool
+	acceptRanges  bool
+	encoded       bool
+
+	// refusesRanges is set when the server answered "Accept-Ranges: none",
+	// which makes a range probe pointless.
+	refusesRanges bool
+
+	etag         string
+	lastModified string
+
+	// validator identifies this version of the file for If-Range: a strong
+	// ETag, or Last-Modified when there is none.
+	validator string
+}
+
+func (f *remoteFile) supportsParallel() bool {
+	return f.acceptRanges && f.knownLength && !f.encoded
+}
+
+// noParallelReason explains why supportsParallel is false.
+func (f *remoteFile) noParallelReason() NoParallelReason {
+	switch {
+	case f.encoded:
+		return ReasonContentEncoded
+	case !f.acceptRanges:
+		return ReasonNoAcceptRanges
+	}
+
+	return ReasonNoContentLength
+}
+
+// probeRemoteFile finds out whether downloadURL can be fetched in parallel and
+// resolves the output file name.
+func probeRemoteFile(ctx context.Context, downloadURL string, opts Options) (*remoteFile, error) {
+	remote, err := probeRanges(ctx, downloadURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	remote.fileName, err = resolveFileName(downloadURL, remote.header, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+// probeRanges learns the size and range support of downloadURL. It starts
+// with a HEAD request and falls back to a one byte ranged GET when HEAD fails
+// or doesn't advertise ranges, since many CDNs reject HEAD or answer it
+// differently.
+func probeRanges(ctx context.Context, downloadURL string, opts Options) (*remoteFile, error) {
+	// A size hint stands in for the probe; the range responses are checked
+	// against it instead.
+	if opts.ExpectedSize > 0 {
+		return &remoteFile{
+			resolvedURL:   downloadURL,
+			header:        http.Header{},
+			contentLength: opts.ExpectedSize,
+			knownLength:   true,
+			acceptRanges:  true,
+		}, nil
+	}
+
+	// HEAD says nothing about what a POST would return.
+	if opts.customMethod() {
+		remote, err := rangeProbe(ctx, downloadURL, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkContentType(remote.header, opts); err != nil {
+			return nil, err
+		}
+
+		return remote, nil
+	}
+
+	remote, headErr := headProbe(ctx, downloadURL, opts)
+
+	// An encoded response can't be split, whatever a range probe would say.
+	if headErr != nil || (!remote.supportsParallel() && !remote.encoded && !remote.refusesRanges) {
+		rangeRemote, err := rangeProbe(ctx, downloadURL, opts)
+
+		switch {
+		case err == nil && (headErr != nil || rangeRemote.supportsParallel()):
+			remote = rangeRemote
+		case headErr != nil:
+			return nil, err
+		}
+	}
+
+	if err := checkContentType(remote.header, opts); err != nil {
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+func headProbe(ctx context.Context, downloadURL string, opts Options) (*remoteFile, error) {
+	// Range requests go straight to the resolved URL instead of following the
+	// same redirects once per chunk.
+	res, err := headRequest(ctx, opts, downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRemoteFile(res.Header, res.Request.URL.String(), opts), nil
+}
+
+// rangeProbe requests the first byte of downloadURL. A 206 response proves
+// range support and its Content-Range carries the total size.
+func rangeProbe(ctx context.Context, downloadURL string, opts Options) (*remoteFile, error) {
+	req, err := newRequest(ctx, http.MethodGet, downloadURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(rangeHeader, "bytes=0-0")
+
+	res, err := opts.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("range probe failed %w", err)
+	}
+
+	_ = res.Body.Close()
+
+	opts.logger().Debug("range probe response", "url", res.Request.URL.String(), "status", res.StatusCode)
+
+	if err := checkStatus(res); err != nil {
+		return nil, fmt.Errorf("range probe failed %w", err)
+	}
+
+	remote := newRemoteFile(res.Header, res.Request.URL.String(), opts)
+
+	if res.StatusCode == http.StatusPartialContent {
+		_, _, total, err := parseContentRange(res.Header.Get(contentRangeHeader))
+
+		remote.acceptRanges = true
+		remote.contentLength, remote.knownLength = total, err == nil
+
+		// It is the digest of the probed byte, not of the file.
+		remote.header.Del(contentDigestHeader)
+	}
+
+	// Without a HEAD probe to go by, the answer to this range request is all
+	// there is.
+	if res.StatusCode != http.StatusPartialContent && opts.customMethod() {
+		remote.acceptRanges = false
+	}
+
+	return remote, nil
+}
+
+func newRemoteFile(headers http.Header, resolvedURL string, opts Options) *remoteFile {
+	contentLength, knownLength := headerLength(headers, opts)
+	acceptRanges, refusesRanges := parseAcceptRanges(headers.Get(acceptRangesHeader))
+
+	return &remoteFile{
+		resolvedURL:   resolvedURL,
+		header:        headers,
+		contentLength: contentLength,
+		knownLength:   knownLength,
+		acceptRanges:  acceptRanges,
+		refusesRanges: refusesRanges,
+		encoded:       isEncoded(headers.Get(contentEncodingHeader)),
+		etag:          headers.Get("ETag"),
+		lastModified:  headers.Get(lastModifiedHeader),
+		validator:     rangeValidator(headers),
+	}
+}
+
+// parseAcceptRanges reads an Accept-Ranges value, a comma separated list of
+// range units. Byte ranges are accepted when "bytes" is listed in any case;
+// refused is set when the list is just "none".
+func parseAcceptRanges(value string) (bytes, refused bool) {
+	var units int
+
+	for _, unit := range strings.Split(value, ",") {
+		unit = strings.TrimSpace(unit)
+
+		switch {
+		case unit == "":
+			continue
+		case strings.EqualFold(unit, "bytes"):
+			return true, false
+		case strings.EqualFold(unit, "none"):
+			refused = true
+		}
+
+		units++
+	}
+
+	return false, refused && units == 1
+}
+
+// rangeValidator picks the value to send as If-Range. Weak ETags can't be
+// used there, so Last-Modified is the fallback.
+func rangeValidator(headers http.Header) string {
+	if etag := headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return headers.Get(lastModifiedHeader)
+}
+
+// parseContentRange parses a "bytes first-last/total" Content-Range value.
+func parseContentRange(value string) (start, stop, total uint64, err error) {
+	invalid := fmt.Errorf("invalid content range %q", value)
+
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, 0, invalid
+	}
+
+	rangePart, totalPart, found := strings.Cut(strings.TrimPrefix(value, "bytes "), "/")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+
+	startPart, stopPart, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+
+	if start, err = strconv.ParseUint(startPart, 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+
+	if stop, err = strconv.ParseUint(stopPart, 10, 64); err != nil || stop < start {
+		return 0, 0, 0, invalid
+	}
+
+	if total, err = strconv.ParseUint(totalPart, 10, 64); err != nil || stop >= total {
+		return 0, 0, 0, invalid
+	}
+
+	return start, stop, total, nil
+}
+
+// unsatisfiedRangeLength reads the "bytes */total" Content-Range of a 416
+// response, which tells the current size of the file.
+func unsatisfiedRangeLength(value string) (uint64, bool) {
+	totalPart, found := strings.CutPrefix(value, "bytes */")
+	if !found {
+		return 0, false
+	}
+
+	total, err := strconv.ParseUint(totalPart, 10, 64)
+
+	return total, err == nil
+}
@@ -0,0 +1,291 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		value              string
+		start, stop, total uint64
+		fails              bool
+	}{
+		{"bytes 0-0/1234", 0, 0, 1234, false},
+		{"bytes 100-199/200", 100, 199, 200, false},
+		{"bytes 0-0/*", 0, 0, 0, true},
+		{"bytes */1234", 0, 0, 0, true},
+		{"bytes 5-4/10", 0, 0, 0, true},
+		{"bytes 0-10/10", 0, 0, 0, true},
+		{"items 0-0/10", 0, 0, 0, true},
+		{"", 0, 0, 0, true},
+	}
+
+	for _, testCase := range cases {
+		start, stop, total, err := parseContentRange(testCase.value)
+		if (err != nil) != testCase.fails {
+			t.Errorf("Failed %q: %v \n", testCase.value, err)
+		}
+
+		if start != testCase.start || stop != testCase.stop || total != testCase.total {
+			t.Errorf("Failed %q: %d-%d/%d \n", testCase.value, start, stop, total)
+		}
+	}
+}
+
+func TestParallelDownloadWhenHeadIsRejected(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	result, err := parallelDownload(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 4,
+		Chunks:           4,
+		OutputDir:        t.TempDir(),
+		HTTPClient:       server.Client(),
+		ProgressOutput:   io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(result.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Failed %d bytes downloaded, expected %d \n", len(data), len(content))
+	}
+}
+
+func TestDownloadExpectedSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	cases := []struct {
+		size     uint64
+		mismatch bool
+	}{
+		{uint64(len(content)), false},
+		{uint64(len(content)) - 1, true},
+		{uint64(len(content)) + 5000, true},
+	}
+
+	for _, testCase := range cases {
+		var probes atomic.Int64
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || r.Header.Get("Range") == "bytes=0-0" {
+				probes.Add(1)
+			}
+
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ExpectedSize:     testCase.size,
+			ParallelRequests: 4,
+			Chunks:           4,
+			OutputDir:        dir,
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if probes.Load() != 0 {
+			t.Errorf("Failed size %d: %d probes sent \n", testCase.size, probes.Load())
+		}
+
+		if testCase.mismatch {
+			if !errors.Is(err, ErrSizeMismatch) {
+				t.Errorf("Failed size %d: %v, expected ErrSizeMismatch \n", testCase.size, err)
+			}
+
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Failed size %d: %d files left behind \n", testCase.size, len(entries))
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, _ := os.ReadFile(result.FileName); !bytes.Equal(data, content) {
+			t.Errorf("Failed size %d: %d bytes downloaded, expected %d \n", testCase.size, len(data), len(content))
+		}
+	}
+}
+
+// roundTripFunc lets a test answer requests without parsing them off the wire.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDownloadFallsBackOnInvalidContentLength(t *testing.T) {
+	content := []byte("served without a usable length")
+
+	for _, contentLength := range []string{"abc", "-5", "18446744073709551615", "9223372036854775808"} {
+		var rangeRequests int
+
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Range") != "" {
+				rangeRequests++
+			}
+
+			body := content
+			if req.Method == http.MethodHead {
+				body = nil
+			}
+
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Status:        "200 OK",
+				Header:        http.Header{"Content-Length": {contentLength}, "Accept-Ranges": {"bytes"}},
+				Body:          io.NopCloser(bytes.NewReader(body)),
+				ContentLength: -1,
+				Request:       req,
+			}, nil
+		})}
+
+		result, err := Download(context.Background(), "http://example.com/file.txt", Options{
+			OutputDir:      t.TempDir(),
+			HTTPClient:     client,
+			ProgressOutput: io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("Failed %s: %v \n", contentLength, err)
+		}
+
+		data, err := os.ReadFile(result.FileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: %q != %q \n", contentLength, data, content)
+		}
+
+		// Only the range probe may ask for a range.
+		if rangeRequests > 1 {
+			t.Errorf("Failed %s: %d range requests \n", contentLength, rangeRequests)
+		}
+	}
+}
+
+func TestParseAcceptRanges(t *testing.T) {
+	cases := []struct {
+		value   string
+		bytes   bool
+		refused bool
+	}{
+		{"bytes", true, false},
+		{"Bytes", true, false},
+		{" BYTES ", true, false},
+		{"bytes, none", true, false},
+		{"pages,bytes", true, false},
+		{"none", false, true},
+		{" None ", false, true},
+		{"pages", false, false},
+		{"pages, none", false, false},
+		{"", false, false},
+	}
+
+	for _, testCase := range cases {
+		acceptsBytes, refused := parseAcceptRanges(testCase.value)
+		if acceptsBytes != testCase.bytes || refused != testCase.refused {
+			t.Errorf("Failed %q: bytes %t refused %t, expected %t %t \n",
+				testCase.value, acceptsBytes, refused, testCase.bytes, testCase.refused)
+		}
+	}
+}
+
+func TestDownloadAcceptRanges(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	cases := []struct {
+		acceptRanges string
+		serveRanges  bool
+		parallel     bool
+	}{
+		{"Bytes", true, true},
+		{"bytes, none", true, true},
+		// An explicit none isn't second-guessed with a range probe.
+		{"none", true, false},
+		{"", false, false},
+	}
+
+	for _, testCase := range cases {
+		var rangeRequests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				rangeRequests.Add(1)
+
+				if testCase.serveRanges {
+					http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+					return
+				}
+			}
+
+			if testCase.acceptRanges != "" {
+				w.Header().Set("Accept-Ranges", testCase.acceptRanges)
+			}
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(content)
+			}
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 4,
+			OutputDir:        t.TempDir(),
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %q: %v \n", testCase.acceptRanges, err)
+		}
+
+		if result.Parallel != testCase.parallel {
+			t.Errorf("Failed %q: parallel %t, expected %t \n", testCase.acceptRanges, result.Parallel, testCase.parallel)
+		}
+
+		if !testCase.parallel && testCase.serveRanges && rangeRequests.Load() > 0 {
+			t.Errorf("Failed %q: %d range requests \n", testCase.acceptRanges, rangeRequests.Load())
+		}
+
+		data, err := os.ReadFile(result.FileName)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("Failed %q: %d bytes, %v \n", testCase.acceptRanges, len(data), err)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package fastdownloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ProgressInterval is the default minimum time between two progress reports.
+const ProgressInterval = 100 * time.Millisecond
+
+// rateSmoothing is the weight of the latest sample in the moving average of
+// the download speed. Chunks finishing at different times make the speed
+// between two reports jumpy, so older samples keep most of the weight.
+const rateSmoothing = 0.3
+
+// progressLineInterval is the minimum time between two progress lines on a
+// writer that isn't a terminal.
+const progressLineInterval = 5 * time.Second
+
+const (
+	// defaultColumns is assumed when the terminal width can't be read.
+	defaultColumns = 80
+
+	// minBarWidth is the narrowest bar worth drawing after the status.
+	minBarWidth = 10
+)
+
+// ProgressBar returns a progress function reporting
+// "Progress [downloaded/total] (percent) speed ETA mm:ss" on w. On a terminal
+// the line is redrawn in place, fitted to the terminal width, and a bar fills
+// the rest of it. Other writers, like log files and CI output, get a line of
+// their own every 5 seconds and once the download completes. The speed is a
+// moving average over the reports; the ETA is left out while the total is
+// unknown.
+func ProgressBar(w io.Writer) func(downloaded, total uint64) {
+	return progressBar(w, time.Now, terminalWidth(w))
+}
+
+// terminalWidth returns a function reporting the width of the terminal w
+// writes to, or nil when w isn't a terminal.
+func terminalWidth(w io.Writer) func() int {
+	file, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return nil
+	}
+
+	return func() int {
+		width, _, err := term.GetSize(int(file.Fd()))
+		if err != nil || width <= 0 {
+			return defaultColumns
+		}
+
+		return width
+	}
+}
+
+func progressBar(w io.Writer, now func() time.Time, width func() int) func(downloaded, total uint64) {
+	var (
+		lastTime  time.Time
+		lastBytes uint64
+		rate      float64
+		lastLine  time.Time
+		completed bool
+	)
+
+	return func(downloaded, total uint64) {
+		reportTime := now()
+
+		if !lastTime.IsZero() && reportTime.After(lastTime) && downloaded >= lastBytes {
+			sample := float64(downloaded-lastBytes) / reportTime.Sub(lastTime).Seconds()
+
+			if rate == 0 {
+				rate = sample
+			} else {
+				rate = rateSmoothing*sample + (1-rateSmoothing)*rate
+			}
+		}
+
+		lastTime, lastBytes = reportTime, downloaded
+
+		status := progressStatus("Progress", downloaded, total, rate)
+
+		if width != nil {
+			fmt.Fprintf(w, "\r%s", fitProgressLine(status, downloaded, total, width()))
+
+			return
+		}
+
+		// Without a terminal every report is a line of its own, so they are
+		// thinned out, but the completion is never missed or repeated.
+		complete := total > 0 && downloaded >= total
+		if complete && completed {
+			return
+		}
+
+		if !complete && !lastLine.IsZero() && reportTime.Sub(lastLine) < progressLineInterval {
+			return
+		}
+
+		lastLine, completed = reportTime, complete
+
+		fmt.Fprintln(w, status)
+	}
+}
+
+// progressStatus formats "label [downloaded/total] (percent) speed ETA".
+func progressStatus(label string, downloaded, total uint64, rate float64) string {
+	var b strings.Builder
+
+	if total == 0 {
+		fmt.Fprintf(&b, "%s [%s]", label, FormatBytes(float64(downloaded), ""))
+	} else {
+		fmt.Fprintf(
+			&b,
+			"%s [%s/%s] (%d%%)",
+			label,
+			FormatBytes(float64(downloaded), ""),
+			FormatBytes(float64(total), ""),
+			percent(downloaded, total),
+		)
+	}
+
+	if rate <= 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, " %s", FormatBytes(rate, "B/s"))
+
+	if total > downloaded {
+		remaining := time.Duration(float64(total-downloaded) / rate * float64(time.Second))
+		fmt.Fprintf(&b, " ETA %s", formatETA(remaining))
+	}
+
+	return b.String()
+}
+
+// fitProgressLine fits status into a terminal of width columns, followed by
+// a bar over the remaining columns when the total is known and there is room.
+// The last column stays empty, since writing it makes some terminals wrap.
+// The line is padded with spaces to overwrite a longer previous one.
+func fitProgressLine(status string, downloaded, total uint64, width int) string {
+	columns := width - 1
+	if columns < 1 {
+		columns = 1
+	}
+
+	line := status
+
+	if barWidth := columns - len(status) - 3; total > 0 && barWidth >= minBarWidth {
+		filled := int(float64(barWidth) * float64(downloaded) / float64(total))
+		if filled > barWidth {
+			filled = barWidth
+		}
+
+		bar := strings.Repeat("=", filled)
+		if filled < barWidth {
+			bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+		}
+
+		line += " [" + bar + "]"
+	}
+
+	if len(line) > columns {
+		return line[:columns]
+	}
+
+	return line + strings.Repeat(" ", columns-len(line))
+}
+
+// formatETA formats d as mm:ss, or h:mm:ss from an hour on.
+func formatETA(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// ProgressPercent returns a progress function that prints the integer
+// percentage on a line of its own whenever it changes. Nothing is printed
+// while the total is unknown.
+func ProgressPercent(w io.Writer) func(downloaded, total uint64) {
+	last := -1
+
+	return func(downloaded, total uint64) {
+		if total == 0 {
+			return
+		}
+
+		if p := percent(downloaded, total); p != last {
+			last = p
+
+			fmt.Fprintln(w, p)
+		}
+	}
+}
+
+// ProgressJSON returns a progress function that prints every report as a
+// {"downloaded":N,"total":M,"percent":P} object on a line of its own. total
+// and percent are zero while the total is unknown.
+func ProgressJSON(w io.Writer) func(downloaded, total uint64) {
+	encoder := json.NewEncoder(w)
+
+	return func(downloaded, total uint64) {
+		report := struct {
+			Downloaded uint64 `json:"downloaded"`
+			Total      uint64 `json:"total"`
+			Percent    int    `json:"percent"`
+		}{Downloaded: downloaded, Total: total}
+
+		if total > 0 {
+			report.Percent = percent(downloaded, total)
+		}
+
+		_ = encoder.Encode(report)
+	}
+}
+
+// ParseProgressFormat returns the progress function for format on w: "bar"
+// (the default when empty), "percent" or "json".
+func ParseProgressFormat(format string, w io.Writer) (func(downloaded, total uint64), error) {
+	switch format {
+	case "", "bar":
+		return ProgressBar(w), nil
+	case "percent":
+		return ProgressPercent(w), nil
+	case "json":
+		return ProgressJSON(w), nil
+	}
+
+	return nil, fmt.Errorf("unknown progress format %q, expected bar, percent or json", format)
+}
+
+func percent(downloaded, total uint64) int {
+	return int(math.Ceil(float64(downloaded) / float64(total) * 100.0)) //nolint:gomnd
+}
+
+// progressWriter counts the bytes of a download and reports them. It is
+// shared by all the chunk goroutines of a download, so readBytes and
+// lastReport must only be accessed atomically. A zero maxBytes means the
+// total is unknown.
+type progressWriter struct {
+	readBytes  uint64
+	lastReport int64
+	maxBytes   uint64
+
+	// interval is the minimum time between two reports in nanoseconds.
+	interval int64
+
+	reportMutex sync.Mutex
+	report      func(downloaded, total uint64)
+
+	// watch and done pass the chunks and the end of the download on to
+	// Options.ProgressServer, if any.
+	watch func([]*chunk)
+	done  func()
+}
+
+func newProgressWriter(opts Options, maxBytes uint64) *progressWriter {
+	p := &progressWriter{
+		maxBytes: maxBytes,
+		interval: int64(opts.progressInterval()),
+		report:   opts.progressFunc(),
+	}
+
+	if opts.ProgressServer != nil {
+		serve, watch, done := opts.ProgressServer.add(maxBytes)
+		report := p.report
+
+		p.report = func(downloaded, total uint64) {
+			serve(downloaded, total)
+			report(downloaded, total)
+		}
+
+		p.watch, p.done = watch, done
+	}
+
+	return p
+}
+
+// watchChunks shows the status of the chunks of a parallel download.
+func (p *progressWriter) watchChunks(chunks []*chunk) {
+	if p.watch != nil {
+		p.watch(chunks)
+	}
+}
+
+func (p *progressWriter) Write(data []byte) (n int, err error) {
+	atomic.AddUint64(&p.readBytes, uint64(len(data)))
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&p.lastReport)
+
+	if now-last >= p.interval && atomic.CompareAndSwapInt64(&p.lastReport, last, now) {
+		p.flush()
+	}
+
+	return len(data), nil
+}
+
+// rewind takes back n counted bytes that have to be downloaded again.
+func (p *progressWriter) rewind(n uint64) {
+	atomic.AddUint64(&p.readBytes, -n)
+}
+
+// finish reports the final count, which throttling may have skipped.
+func (p *progressWriter) finish() {
+	p.flush()
+
+	if p.done != nil {
+		p.done()
+	}
+}
+
+func (p *progressWriter) flush() {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+
+	p.report(atomic.LoadUint64(&p.readBytes), p.maxBytes)
+}
@@ -0,0 +1,309 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressWriterConcurrentWrites(t *testing.T) {
+	const (
+		writers = 8
+		writes  = 100
+	)
+
+	var reported uint64
+
+	progress := &progressWriter{
+		maxBytes: writers * writes * 10,
+		report:   func(downloaded, total uint64) { reported = downloaded },
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < writes; j++ {
+				_, _ = progress.Write(make([]byte, 10))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	progress.finish()
+
+	if progress.readBytes != writers*writes*10 {
+		t.Errorf("Failed %d != %d \n", progress.readBytes, writers*writes*10)
+	}
+
+	if reported != writers*writes*10 {
+		t.Errorf("Failed reported %d != %d \n", reported, writers*writes*10)
+	}
+}
+
+func TestProgressWriterUnknownTotal(t *testing.T) {
+	var output strings.Builder
+
+	progress := &progressWriter{maxBytes: 0, report: ProgressBar(&output)}
+
+	_, _ = progress.Write(make([]byte, 1536))
+	progress.finish()
+
+	if output.String() != "Progress [1.5 Ki]\n" {
+		t.Errorf("Failed %q != %q \n", output.String(), "Progress [1.5 Ki]\n")
+	}
+}
+
+func TestProgressWriterInterval(t *testing.T) {
+	cases := []struct {
+		interval   time.Duration
+		maxReports int
+	}{
+		// A write every millisecond for 300ms, and a final report.
+		{100 * time.Millisecond, 5},
+		{50 * time.Millisecond, 8},
+	}
+
+	for _, testCase := range cases {
+		var reports int
+
+		progress := newProgressWriter(Options{
+			ProgressInterval: testCase.interval,
+			ProgressFunc:     func(downloaded, total uint64) { reports++ },
+		}, 0)
+
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			_, _ = progress.Write(make([]byte, 10))
+
+			time.Sleep(time.Millisecond)
+		}
+
+		progress.finish()
+
+		if reports < 2 || reports > testCase.maxReports {
+			t.Errorf("Failed %s: %d reports, expected at most %d \n", testCase.interval, reports, testCase.maxReports)
+		}
+	}
+}
+
+func TestProgressFunc(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var (
+		reportMutex sync.Mutex
+		reports     [][2]uint64
+	)
+
+	_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		ParallelRequests: 4,
+		OutputDir:        t.TempDir(),
+		HTTPClient:       server.Client(),
+		BufferSize:       100,
+		ProgressOutput:   io.Discard,
+		ProgressFunc: func(downloaded, total uint64) {
+			reportMutex.Lock()
+			reports = append(reports, [2]uint64{downloaded, total})
+			reportMutex.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1000 writes of 100 bytes complete well within a few intervals.
+	if len(reports) == 0 || len(reports) > 100 {
+		t.Fatalf("Failed %d progress reports \n", len(reports))
+	}
+
+	for i, report := range reports {
+		if report[1] != uint64(len(content)) {
+			t.Errorf("Failed report %d: total %d \n", i, report[1])
+		}
+
+		if i > 0 && report[0] < reports[i-1][0] {
+			t.Errorf("Failed report %d went backwards: %d < %d \n", i, report[0], reports[i-1][0])
+		}
+	}
+
+	if last := reports[len(reports)-1]; last[0] != uint64(len(content)) {
+		t.Errorf("Failed final report %d, expected %d \n", last[0], len(content))
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	cases := []struct {
+		downloaded uint64
+		total      uint64
+		expected   string
+	}{
+		{512, 1024, "Progress [512.0 /1.0 Ki] (50%)"},
+		{2048, 0, "Progress [2.0 Ki]"},
+	}
+
+	for _, testCase := range cases {
+		var output strings.Builder
+
+		ProgressBar(&output)(testCase.downloaded, testCase.total)
+
+		if output.String() != testCase.expected+"\n" {
+			t.Errorf("Failed %q != %q \n", output.String(), testCase.expected)
+		}
+	}
+}
+
+func TestProgressBarSpeedAndETA(t *testing.T) {
+	var (
+		output strings.Builder
+		clock  = time.Unix(0, 0)
+	)
+
+	report := progressBar(&output, func() time.Time { return clock }, func() int { return 100 })
+
+	// 1 MiB/s, then a burst to 2 MiB/s that the moving average dampens to
+	// 1.3 MiB/s.
+	for _, downloaded := range []uint64{0, 1 << 20, 3 << 20} {
+		output.Reset()
+		report(downloaded, 10<<20)
+		clock = clock.Add(time.Second)
+	}
+
+	if expected := "\rProgress [3.0 Mi/10.0 Mi] (30%) 1.3 MiB/s ETA 00:05 [=============>"; !strings.HasPrefix(output.String(), expected) {
+		t.Errorf("Failed %q doesn't start with %q \n", output.String(), expected)
+	}
+
+	output.Reset()
+	report(4<<20, 0)
+
+	if expected := "\rProgress [4.0 Mi] 1.2 MiB/s "; !strings.HasPrefix(output.String(), expected) || len(output.String()) != 100 {
+		t.Errorf("Failed unknown total: %q \n", output.String())
+	}
+}
+
+func TestProgressBarLines(t *testing.T) {
+	var (
+		output strings.Builder
+		clock  = time.Unix(0, 0)
+	)
+
+	report := progressBar(&output, func() time.Time { return clock }, nil)
+
+	// Reports a second apart only print a line every 5 seconds and the
+	// completion once.
+	for downloaded := uint64(0); downloaded <= 10; downloaded++ {
+		report(downloaded<<20, 10<<20)
+		clock = clock.Add(time.Second)
+	}
+
+	report(10<<20, 10<<20)
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+
+	expected := []string{"Progress [0.0 /10.0 Mi] (0%)", "Progress [5.0 Mi/10.0 Mi] (50%)", "Progress [10.0 Mi/10.0 Mi] (100%)"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Failed %q \n", output.String())
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("Failed line %d: %q doesn't start with %q \n", i, line, expected[i])
+		}
+	}
+}
+
+func TestFitProgressLine(t *testing.T) {
+	status := "Progress [1.0 /2.0 Ki] (50%)"
+
+	cases := []struct {
+		width    int
+		total    uint64
+		expected string
+	}{
+		// Room for a 20 column bar half of which is filled.
+		{len(status) + 24, 2048, status + " [==========>         ]"},
+		// Too narrow for a bar, the status is padded.
+		{len(status) + 10, 2048, status + "         "},
+		// No bar while the total is unknown.
+		{len(status) + 24, 0, status + strings.Repeat(" ", 23)},
+		// Narrower than the status, it is cut off.
+		{11, 2048, "Progress ["},
+		{0, 2048, "P"},
+	}
+
+	for _, testCase := range cases {
+		line := fitProgressLine(status, 1024, testCase.total, testCase.width)
+		if line != testCase.expected {
+			t.Errorf("Failed width %d: %q != %q \n", testCase.width, line, testCase.expected)
+		}
+	}
+
+	if line := fitProgressLine(status, 4096, 2048, len(status)+14); line != status+" [==========]" {
+		t.Errorf("Failed overfull bar %q \n", line)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	cases := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{42 * time.Second, "00:42"},
+		{61*time.Minute + 5*time.Second, "1:01:05"},
+		{1500 * time.Millisecond, "00:02"},
+	}
+
+	for _, testCase := range cases {
+		if formatted := formatETA(testCase.duration); formatted != testCase.expected {
+			t.Errorf("Failed %s: %s != %s \n", testCase.duration, formatted, testCase.expected)
+		}
+	}
+}
+
+func TestProgressFormats(t *testing.T) {
+	cases := []struct {
+		format   string
+		reports  [][2]uint64
+		expected string
+	}{
+		{"percent", [][2]uint64{{1, 3}, {1, 3}, {2, 3}, {3, 3}}, "34\n67\n100\n"},
+		{"percent", [][2]uint64{{100, 0}}, ""},
+		{"json", [][2]uint64{{512, 1024}}, `{"downloaded":512,"total":1024,"percent":50}` + "\n"},
+		{"json", [][2]uint64{{2048, 0}}, `{"downloaded":2048,"total":0,"percent":0}` + "\n"},
+	}
+
+	for _, testCase := range cases {
+		var output strings.Builder
+
+		report, err := ParseProgressFormat(testCase.format, &output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range testCase.reports {
+			report(r[0], r[1])
+		}
+
+		if output.String() != testCase.expected {
+			t.Errorf("Failed %s: %q != %q \n", testCase.format, output.String(), testCase.expected)
+		}
+	}
+
+	if _, err := ParseProgressFormat("dots", io.Discard); err == nil {
+		t.Errorf("Failed unknown format accepted \n")
+	}
+}
@@ -0,0 +1,266 @@
+package fastdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressShutdownTimeout bounds how long Serve waits for requests in
+// flight once its context is done.
+const progressShutdownTimeout = 5 * time.Second
+
+// ProgressServer serves the progress of downloads as JSON on /progress, e.g.
+// to watch a long unattended download from another machine. Pass it as
+// Options.ProgressServer; it may be shared by several downloads, whose
+// totals add up.
+type ProgressServer struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	now    func() time.Time
+	active []*progressEntry
+
+	// finished and finishedBytes count the downloads already done.
+	finished      int
+	finishedBytes uint64
+}
+
+// progressEntry is the state of a download served by a ProgressServer.
+type progressEntry struct {
+	downloaded uint64
+	total      uint64
+
+	// rate is a moving average of the speed like the progress bar's.
+	rate      float64
+	lastTime  time.Time
+	lastBytes uint64
+
+	chunks []*chunk
+}
+
+// ProgressReport is the JSON document served on /progress. Speed is in bytes
+// per second and ETA in seconds; both are zero until they are known, as are
+// Total and Percent for downloads of unknown size.
+type ProgressReport struct {
+	Downloaded uint64  `json:"downloaded"`
+	Total      uint64  `json:"total"`
+	Percent    int     `json:"percent"`
+	Speed      float64 `json:"speed"`
+	ETA        int64   `json:"eta"`
+
+	// Completed is the number of downloads done, which stay in the totals.
+	Completed int `json:"completed"`
+
+	// Downloads are the running downloads.
+	Downloads []DownloadReport `json:"downloads"`
+}
+
+// DownloadReport is the progress of a running download. Chunks is empty for
+// single requests.
+type DownloadReport struct {
+	Downloaded uint64        `json:"downloaded"`
+	Total      uint64        `json:"total"`
+	Percent    int           `json:"percent"`
+	Speed      float64       `json:"speed"`
+	ETA        int64         `json:"eta"`
+	Chunks     []ChunkReport `json:"chunks"`
+}
+
+// ChunkReport is a byte range of a parallel download. Status is "pending",
+// "downloading" or "done".
+type ChunkReport struct {
+	Start   uint64 `json:"start"`
+	Stop    uint64 `json:"stop"`
+	Written uint64 `json:"written"`
+	Status  string `json:"status"`
+}
+
+// NewProgressServer listens on addr, e.g. ":8080" or "localhost:0" for a
+// free port. Nothing is served before Serve.
+func NewProgressServer(addr string) (*ProgressServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProgressServer{listener: listener, now: time.Now}, nil
+}
+
+// Addr is the address the server listens on.
+func (s *ProgressServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve answers requests until ctx is done, then shuts down gracefully and
+// returns nil.
+func (s *ProgressServer) Serve(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Report())
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: progressShutdownTimeout}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(s.listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), progressShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = serveErr
+	}
+
+	return err
+}
+
+// Report returns the progress served on /progress.
+func (s *ProgressServer) Report() ProgressReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := ProgressReport{
+		Downloaded: s.finishedBytes,
+		Total:      s.finishedBytes,
+		Completed:  s.finished,
+		Downloads:  []DownloadReport{},
+	}
+
+	knownTotal := true
+
+	for _, entry := range s.active {
+		download := entry.report()
+
+		report.Downloaded += download.Downloaded
+		report.Total += download.Total
+		report.Speed += download.Speed
+		report.Downloads = append(report.Downloads, download)
+
+		knownTotal = knownTotal && download.Total > 0
+	}
+
+	if !knownTotal {
+		report.Total = 0
+	}
+
+	report.Percent, report.ETA = progressEstimate(report.Downloaded, report.Total, report.Speed)
+
+	return report
+}
+
+// add serves a download of total bytes, zero when unknown. The returned
+// progress function takes its reports and watch its chunks; done moves it to
+// the completed downloads.
+func (s *ProgressServer) add(total uint64) (progress func(downloaded, total uint64), watch func([]*chunk), done func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &progressEntry{total: total}
+	s.active = append(s.active, entry)
+
+	progress = func(downloaded, total uint64) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		entry.update(s.now(), downloaded, total)
+	}
+
+	watch = func(chunks []*chunk) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		entry.chunks = chunks
+	}
+
+	done = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, e := range s.active {
+			if e == entry {
+				s.active = append(s.active[:i], s.active[i+1:]...)
+				s.finished++
+				s.finishedBytes += entry.downloaded
+
+				return
+			}
+		}
+	}
+
+	return progress, watch, done
+}
+
+func (e *progressEntry) update(now time.Time, downloaded, total uint64) {
+	if !e.lastTime.IsZero() && now.After(e.lastTime) && downloaded >= e.lastBytes {
+		sample := float64(downloaded-e.lastBytes) / now.Sub(e.lastTime).Seconds()
+
+		if e.rate == 0 {
+			e.rate = sample
+		} else {
+			e.rate = rateSmoothing*sample + (1-rateSmoothing)*e.rate
+		}
+	}
+
+	e.lastTime, e.lastBytes = now, downloaded
+	e.downloaded, e.total = downloaded, total
+}
+
+func (e *progressEntry) report() DownloadReport {
+	report := DownloadReport{
+		Downloaded: e.downloaded,
+		Total:      e.total,
+		Speed:      e.rate,
+		Chunks:     []ChunkReport{},
+	}
+
+	report.Percent, report.ETA = progressEstimate(e.downloaded, e.total, e.rate)
+
+	for _, c := range e.chunks {
+		written := atomic.LoadUint64(&c.Written)
+
+		status := "downloading"
+
+		switch {
+		case written == 0:
+			status = "pending"
+		case written >= c.size():
+			status = "done"
+		}
+
+		report.Chunks = append(report.Chunks, ChunkReport{Start: c.Start, Stop: c.Stop, Written: written, Status: status})
+	}
+
+	return report
+}
+
+// progressEstimate returns the percentage and the seconds left of a
+// download, zero when they aren't known.
+func progressEstimate(downloaded, total uint64, rate float64) (int, int64) {
+	if total == 0 {
+		return 0, 0
+	}
+
+	var eta int64
+	if rate > 0 && downloaded < total {
+		eta = int64(time.Duration(float64(total-downloaded) / rate * float64(time.Second)).Round(time.Second).Seconds())
+	}
+
+	return percent(downloaded, total), eta
+}
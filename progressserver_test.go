@@ -0,0 +1,151 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProgressServer(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	release := make(chan struct{})
+
+	// Every range request sends the first half of its bytes and the rest
+	// once released.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(acceptRangesHeader, "bytes")
+
+		if r.Method == http.MethodHead {
+			w.Header().Set(contentLengthHeader, strconv.Itoa(len(content)))
+
+			return
+		}
+
+		var start, stop int
+		if _, err := fmt.Sscanf(r.Header.Get(rangeHeader), "bytes=%d-%d", &start, &stop); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set(contentRangeHeader, fmt.Sprintf("bytes %d-%d/%d", start, stop, len(content)))
+		w.Header().Set(contentLengthHeader, strconv.Itoa(stop-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+
+		half := start + (stop-start+1)/2
+
+		_, _ = w.Write(content[start:half])
+		w.(http.Flusher).Flush()
+
+		<-release
+
+		_, _ = w.Write(content[half : stop+1])
+	}))
+	defer server.Close()
+
+	progress, err := NewProgressServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- progress.Serve(ctx)
+	}()
+
+	downloaded := make(chan error, 1)
+
+	go func() {
+		_, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:           4,
+			ProgressServer:   progress,
+			ProgressInterval: time.Millisecond,
+			OutputPath:       filepath.Join(t.TempDir(), "file.bin"),
+			ProgressOutput:   io.Discard,
+		})
+		downloaded <- err
+	}()
+
+	progressURL := "http://" + progress.Addr().String() + "/progress"
+
+	// Mid-download every chunk has half of its bytes.
+	var report ProgressReport
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		res, err := http.Get(progressURL)
+		if err != nil {
+			t.Fatalf("Failed %v \n", err)
+		}
+
+		report = ProgressReport{}
+		err = json.NewDecoder(res.Body).Decode(&report)
+		_ = res.Body.Close()
+
+		if err != nil {
+			t.Fatalf("Failed %v \n", err)
+		}
+
+		if midDownload(report, len(content)) || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	close(release)
+
+	if !midDownload(report, len(content)) {
+		t.Fatalf("Failed report %+v mid-download \n", report)
+	}
+
+	if report.Total != uint64(len(content)) || report.Downloaded == 0 || report.Completed != 0 {
+		t.Errorf("Failed report %+v mid-download \n", report)
+	}
+
+	if err := <-downloaded; err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	report = progress.Report()
+	if report.Completed != 1 || report.Downloaded != uint64(len(content)) || len(report.Downloads) != 0 ||
+		report.Percent != 100 {
+		t.Errorf("Failed report %+v after the download \n", report)
+	}
+
+	cancel()
+
+	if err := <-served; err != nil {
+		t.Errorf("Failed shutdown %v \n", err)
+	}
+
+	if res, err := http.Get(progressURL); err == nil {
+		_ = res.Body.Close()
+		t.Errorf("Failed progress still served after shutdown \n")
+	}
+}
+
+// midDownload reports whether report shows one download of size bytes with
+// four chunks of which half is written.
+func midDownload(report ProgressReport, size int) bool {
+	if len(report.Downloads) != 1 || len(report.Downloads[0].Chunks) != 4 {
+		return false
+	}
+
+	for _, c := range report.Downloads[0].Chunks {
+		if c.Status != "downloading" || c.Written != (c.Stop-c.Start+1)/2 {
+			return false
+		}
+	}
+
+	return report.Downloads[0].Total == uint64(size)
+}
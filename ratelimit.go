@@ -0,0 +1,157 @@
+package fastdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var byteSizeSuffixes = []struct {
+	suffix     string
+	multiplier uint64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"TIB", 1 << 40},
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses a human readable size such as "512K", "2MB" or
+// "1.5GiB". Like curl and wget, suffixes are binary multiples (1K = 1024).
+func ParseByteSize(value string) (uint64, error) {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := uint64(1)
+
+	for _, s := range byteSizeSuffixes {
+		if strings.HasSuffix(number, s.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, s.suffix))
+			multiplier = s.multiplier
+
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 || math.IsNaN(size) || math.IsInf(size, 0) {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	// float64(math.MaxUint64) rounds up to 2^64, the first value that
+	// doesn't fit.
+	bytes := size * float64(multiplier)
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+
+	return uint64(bytes), nil
+}
+
+// rateLimiter is a token bucket shared by every connection of a download,
+// so the cap applies to the aggregate throughput.
+type rateLimiter struct {
+	m              sync.Mutex
+	bytesPerSecond float64
+	burst          float64
+	tokens         float64
+	last           time.Time
+}
+
+func newRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	const burstsPerSecond = 10
+
+	burst := float64(bytesPerSecond) / burstsPerSecond
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		burst:          burst,
+		tokens:         burst,
+		last:           time.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, sleeping until the debt is paid off.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.m.Lock()
+
+	now := time.Now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSecond
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.bytesPerSecond * float64(time.Second))
+	}
+
+	l.m.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	return sleepContext(ctx, delay)
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// limitReader throttles reader with the download's rate limiter, if any, and
+// holds it while the Controller is paused.
+func (o Options) limitReader(ctx context.Context, reader io.Reader) io.Reader {
+	return o.limitRangeReader(ctx, reader, false)
+}
+
+// limitRangeReader is limitReader for the body of a range request, whose
+// connection is released with errPaused when the Controller closes
+// connections.
+func (o Options) limitRangeReader(ctx context.Context, reader io.Reader, release bool) io.Reader {
+	if o.Controller != nil {
+		reader = &pausedReader{ctx: ctx, reader: reader, controller: o.Controller, release: release}
+	}
+
+	if o.limiter == nil {
+		return reader
+	}
+
+	return &rateLimitedReader{ctx: ctx, reader: reader, limiter: o.limiter}
+}
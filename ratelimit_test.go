@@ -0,0 +1,77 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected uint64
+		fails    bool
+	}{
+		{"100", 100, false},
+		{"100B", 100, false},
+		{"2K", 2048, false},
+		{"2kb", 2048, false},
+		{"2MB", 2 << 20, false},
+		{"1.5GiB", 3 << 29, false},
+		{"1 G", 1 << 30, false},
+		{"MB", 0, true},
+		{"-1MB", 0, true},
+		{"ten", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"-Inf", 0, true},
+		{"1e30", 0, true},
+		{"16777216T", 0, true},
+		{"16777215T", (1<<24 - 1) << 40, false},
+	}
+
+	for _, testCase := range cases {
+		size, err := ParseByteSize(testCase.value)
+		if (err != nil) != testCase.fails {
+			t.Errorf("Failed %s: %v \n", testCase.value, err)
+		}
+
+		if size != testCase.expected {
+			t.Errorf("Failed %s: %d != %d \n", testCase.value, size, testCase.expected)
+		}
+	}
+}
+
+func TestRateLimiterIsShared(t *testing.T) {
+	const (
+		rate    = 100 * 1024
+		readers = 4
+		size    = 10 * 1024
+	)
+
+	opts := Options{limiter: newRateLimiter(rate)}
+	startTime := time.Now()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			reader := opts.limitReader(context.Background(), bytes.NewReader(make([]byte, size)))
+			_, _ = io.Copy(io.Discard, reader)
+		}()
+	}
+
+	wg.Wait()
+
+	// 40KiB at 100KiB/s minus the initial burst takes at least 300ms.
+	if elapsed := time.Since(startTime); elapsed < 300*time.Millisecond {
+		t.Errorf("Failed rate limit not applied, took %s \n", elapsed)
+	}
+}
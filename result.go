@@ -0,0 +1,92 @@
+package fastdownloader
+
+import (
+	"fmt"
+	"time"
+)
+
+// Result describes a finished download.
+type Result struct {
+	// FileName is the path the download was saved to.
+	FileName string
+
+	// URL is where the download came from after following redirects. It is
+	// empty for downloads to stdout and skipped files.
+	URL string
+
+	// Bytes is the number of bytes transferred. Bytes restored from an
+	// interrupted earlier attempt aren't counted.
+	Bytes uint64
+
+	// Duration is the time spent probing, downloading and verifying.
+	Duration time.Duration
+
+	// Parallel is set when the file was fetched as byte ranges, and Chunks
+	// is their number; a single request counts as one chunk.
+	Parallel bool
+	Chunks   int
+
+	// Checksum is the "algorithm:hex" digest of the saved file whenever it
+	// was hashed or is known without hashing it: the verified
+	// Options.Checksum or checksum list entry, the sha256 of a written
+	// manifest, or the verified server digest. It is empty otherwise.
+	Checksum string
+
+	// Skipped is set when nothing was downloaded because NoClobber found
+	// FileName already present, or because it was up to date.
+	Skipped bool
+
+	// UpToDate is set along with Skipped when the existing file was found up
+	// to date by its manifest or by Options.Newer.
+	UpToDate bool
+
+	// Trace summarizes the requests of a download with Options.Trace, or is
+	// nil without it.
+	Trace *TraceSummary
+}
+
+// completedResult describes the download of url saved as fileName, whose
+// manifest collected the details, and whose checksum finishDownload returned.
+func completedResult(fileName, url string, written uint64, parallel bool, manifest *Manifest, checksum string) Result {
+	result := Result{FileName: fileName, URL: url, Bytes: written, Parallel: parallel, Chunks: manifest.Chunks, Checksum: checksum}
+
+	if result.Checksum == "" && manifest.SHA256 != "" {
+		result.Checksum = "sha256:" + manifest.SHA256
+	}
+
+	return result
+}
+
+// Speed returns the average transfer rate in bytes per second, or zero when
+// no time elapsed.
+func (r Result) Speed() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// String summarizes the download, e.g. "Downloaded 1.4 GiB in 23s (62.3 MiB/s,
+// 8 chunks)".
+func (r Result) String() string {
+	if r.UpToDate {
+		return fmt.Sprintf("File %s is up to date, skipping", r.FileName)
+	}
+
+	if r.Skipped {
+		return fmt.Sprintf("File %s exists, skipping", r.FileName)
+	}
+
+	speed := FormatBytes(r.Speed(), "B/s")
+	if r.Parallel {
+		speed += fmt.Sprintf(", %d chunks", r.Chunks)
+	}
+
+	return fmt.Sprintf(
+		"Downloaded %s in %s (%s)",
+		FormatBytes(float64(r.Bytes), "B"),
+		r.Duration.Round(time.Millisecond),
+		speed,
+	)
+}
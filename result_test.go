@@ -0,0 +1,78 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultString(t *testing.T) {
+	cases := []struct {
+		result   Result
+		expected string
+	}{
+		{Result{Bytes: 1536 * 1024 * 1024, Duration: 24 * time.Second}, "Downloaded 1.5 GiB in 24s (64.0 MiB/s)"},
+		{Result{Bytes: 100, Duration: 0}, "Downloaded 100.0 B in 0s (0.0 B/s)"},
+		{Result{Bytes: 0, Duration: time.Second}, "Downloaded 0.0 B in 1s (0.0 B/s)"},
+		{Result{Bytes: 8 << 20, Duration: time.Second, Parallel: true, Chunks: 8}, "Downloaded 8.0 MiB in 1s (8.0 MiB/s, 8 chunks)"},
+		{Result{FileName: "file.bin", Skipped: true}, "File file.bin exists, skipping"},
+		{Result{FileName: "file.bin", Skipped: true, UpToDate: true}, "File file.bin is up to date, skipping"},
+	}
+
+	for _, testCase := range cases {
+		if s := testCase.result.String(); s != testCase.expected {
+			t.Errorf("Failed %q != %q \n", s, testCase.expected)
+		}
+	}
+}
+
+func TestDownloadResult(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	for _, acceptRanges := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 4,
+			Chunks:           4,
+			Checksum:         checksum,
+			OutputDir:        t.TempDir(),
+			ProgressOutput:   io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed accept ranges %t: %v \n", acceptRanges, err)
+		}
+
+		expectedChunks := 1
+		if acceptRanges {
+			expectedChunks = 4
+		}
+
+		if result.Parallel != acceptRanges || result.Chunks != expectedChunks {
+			t.Errorf("Failed accept ranges %t: parallel %t with %d chunks \n", acceptRanges, result.Parallel, result.Chunks)
+		}
+
+		if result.Bytes != uint64(len(content)) || result.Checksum != checksum || result.Duration <= 0 {
+			t.Errorf("Failed accept ranges %t: %+v \n", acceptRanges, result)
+		}
+	}
+}
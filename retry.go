@@ -0,0 +1,219 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRetries is the number of times the command line retries a failed
+	// range request.
+	DefaultRetries = 3
+
+	// DefaultRetryBaseDelay is the delay before the first retry. It doubles
+	// with every subsequent attempt.
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+
+	// MaxRetryAfter caps the wait a Retry-After header can ask for, so a
+	// server can't stall a download for hours.
+	MaxRetryAfter = 5 * time.Minute
+)
+
+// StatusError is returned when the server answers with an unexpected HTTP
+// status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+
+	// RetryAfter is the wait a 429 or 503 response asked for with its
+	// Retry-After header, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %s", e.Status)
+}
+
+func checkStatus(res *http.Response) error {
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		err := &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			err.RetryAfter, _ = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After value, either a number of seconds or
+// an HTTP date, into the time to wait from now on. A date in the past means
+// no wait, and no wait is longer than MaxRetryAfter.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else {
+		date, err := http.ParseTime(value)
+		if err != nil {
+			return 0, false
+		}
+
+		wait = date.Sub(now)
+	}
+
+	if wait < 0 {
+		return 0, true
+	}
+
+	if wait > MaxRetryAfter {
+		return MaxRetryAfter, true
+	}
+
+	return wait, true
+}
+
+// isRetryable reports whether err is transient: a network failure, a body
+// cut short, a corrupt chunk, a 429 or a 5xx response. Client errors and a
+// canceled context are final.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrChunkMismatch) || errors.As(err, &netErr)
+}
+
+// retryDelay is the exponential backoff before retry attempt, or the wait a
+// Retry-After header asked for when that is longer.
+func retryDelay(baseDelay time.Duration, attempt int, err error) time.Duration {
+	delay := baseDelay << uint(attempt)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+
+	return delay
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// downloadRangeWithRetry downloads c into asm, retrying transient failures
+// with exponential backoff, or as long as a Retry-After header asks. Every
+// attempt continues from the bytes already written, so nothing is fetched
+// twice. Every attempt goes to the mirror the pool picks; a failed attempt
+// moves on to another mirror, and every mirror gets a chance before the chunk
+// fails, whatever the error and the number of retries.
+func downloadRangeWithRetry(
+	ctx context.Context,
+	opts Options,
+	asm Assembler,
+	progress io.Writer,
+	c *chunk,
+	pool *mirrorPool,
+) error {
+	baseDelay := opts.RetryBaseDelay
+	if baseDelay == 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+
+	tried := make([]bool, len(pool.mirrors))
+
+	for attempt := 0; ; attempt++ {
+		i := pool.acquire(tried)
+		tried[i] = true
+		m := pool.mirrors[i]
+
+		written, started := atomic.LoadUint64(&c.Written), time.Now()
+
+		err := downloadRangeBytes(ctx, opts, asm, progress, c, m)
+		transferred := atomic.LoadUint64(&c.Written) - written
+
+		if err == nil {
+			err = verifyChunk(opts, asm, progress, c, m.contentLength)
+		}
+
+		paused := errors.Is(err, errPaused)
+
+		pool.release(i, transferred, time.Since(started), err != nil && ctx.Err() == nil && !paused)
+
+		if err == nil {
+			return nil
+		}
+
+		// A pause isn't a failure: the chunk continues from where it stopped
+		// once resumed, without using up an attempt or a mirror.
+		if paused {
+			if err := opts.Controller.wait(ctx); err != nil {
+				return fmt.Errorf("range %d-%d: %w", c.Start, c.Stop, err)
+			}
+
+			tried[i] = false
+			attempt--
+
+			continue
+		}
+
+		if attempt < len(pool.mirrors)-1 && ctx.Err() == nil {
+			opts.logger().Info("trying the next mirror",
+				"start", c.Start, "stop", c.Stop, "url", m.url, "error", err)
+
+			continue
+		}
+
+		if attempt >= opts.Retries || !isRetryable(err) {
+			return contextError(ctx, fmt.Errorf("range %d-%d: %w", c.Start, c.Stop, err))
+		}
+
+		delay := retryDelay(baseDelay, attempt, err)
+		opts.logger().Info("retrying range request",
+			"start", c.Start, "stop", c.Stop, "attempt", attempt+1, "delay", delay, "error", err)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return fmt.Errorf("range %d-%d: %w", c.Start, c.Stop, err)
+		}
+	}
+}
+
+// contextError makes sure err matches ctx.Err() once ctx is done. Transports
+// don't always wrap the context error when a canceled request fails.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+
+	return err
+}
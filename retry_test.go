@@ -0,0 +1,236 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadRangeWithRetry(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+
+	cases := []struct {
+		failures   int32
+		status     int
+		retries    int
+		requests   int32
+		shouldFail bool
+	}{
+		{2, http.StatusServiceUnavailable, 3, 3, false},
+		{5, http.StatusServiceUnavailable, 2, 3, true},
+		{1, http.StatusNotFound, 3, 1, true},
+	}
+
+	for _, testCase := range cases {
+		var requests int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= testCase.failures {
+				w.WriteHeader(testCase.status)
+
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}))
+
+		file, err := os.OpenFile(filepath.Join(t.TempDir(), "file"), os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &chunk{Start: 5, Stop: 14}
+
+		err = downloadRangeWithRetry(
+			context.Background(),
+			Options{
+				HTTPClient:     server.Client(),
+				Retries:        testCase.retries,
+				RetryBaseDelay: time.Millisecond,
+			},
+			&WriterAtAssembler{Dst: file},
+			io.Discard,
+			c,
+			newMirrorPool([]mirror{{url: server.URL}}),
+		)
+
+		server.Close()
+
+		if (err != nil) != testCase.shouldFail {
+			t.Errorf("Unexpected error %v \n", err)
+		}
+
+		if requests != testCase.requests {
+			t.Errorf("Failed %d requests, expected %d \n", requests, testCase.requests)
+		}
+
+		if testCase.shouldFail {
+			_ = file.Close()
+
+			continue
+		}
+
+		data := make([]byte, c.size())
+
+		_, err = file.ReadAt(data, int64(c.Start))
+
+		_ = file.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, content[5:15]) {
+			t.Errorf("Failed %q \n", data)
+		}
+	}
+}
+
+func TestDownloadRangeLogsAttempts(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte("0123456789")))
+	}))
+	defer server.Close()
+
+	file, err := os.OpenFile(filepath.Join(t.TempDir(), "file"), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	var logs bytes.Buffer
+
+	err = downloadRangeWithRetry(
+		context.Background(),
+		Options{
+			HTTPClient:     server.Client(),
+			Retries:        1,
+			RetryBaseDelay: time.Millisecond,
+			Logger:         slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		},
+		&WriterAtAssembler{Dst: file},
+		io.Discard,
+		&chunk{Start: 0, Stop: 9},
+		newMirrorPool([]mirror{{url: server.URL}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"range request started",
+		"status=503",
+		"retrying range request",
+		"attempt=1",
+		"status=206",
+		"range request finished",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Failed %q missing from logs \n%s", expected, logs.String())
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, expected := range []time.Duration{100, 200, 400, 800} {
+		if delay := retryDelay(100, attempt, nil); delay != expected {
+			t.Errorf("Failed %d != %d \n", delay, expected)
+		}
+	}
+
+	// Retry-After only ever makes the delay longer.
+	err := &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 300}
+	for attempt, expected := range []time.Duration{300, 300, 400} {
+		if delay := retryDelay(100, attempt, err); delay != expected {
+			t.Errorf("Failed Retry-After %d != %d \n", delay, expected)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"Tue, 02 Jan 2024 03:05:35 GMT", 90 * time.Second, true},
+		{"86400", MaxRetryAfter, true},
+		{now.Add(24 * time.Hour).Format(http.TimeFormat), MaxRetryAfter, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"1.5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, testCase := range cases {
+		delay, ok := parseRetryAfter(testCase.value, now)
+		if delay != testCase.expected || ok != testCase.ok {
+			t.Errorf("Failed %q: %s %t, expected %s %t \n", testCase.value, delay, ok, testCase.expected, testCase.ok)
+		}
+	}
+}
+
+func TestDownloadRangeHonorsRetryAfter(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte("0123456789")))
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	started := time.Now()
+
+	err = downloadRangeWithRetry(
+		context.Background(),
+		Options{HTTPClient: server.Client(), Retries: 1, RetryBaseDelay: time.Millisecond},
+		&WriterAtAssembler{Dst: file},
+		io.Discard,
+		&chunk{Start: 0, Stop: 9},
+		newMirrorPool([]mirror{{url: server.URL}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("Failed retried after %s, expected the 1s Retry-After \n", elapsed)
+	}
+}
@@ -0,0 +1,162 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// checkSink rejects Options.Sink and Options.Assembler combinations Download
+// can't serve.
+func checkSink(downloadURL string, opts Options) error {
+	kind := "a Sink"
+	if opts.Assembler != nil {
+		kind = "an Assembler"
+	}
+
+	switch {
+	case opts.sinkAssembler() == nil:
+		return nil
+	case opts.Sink != nil && opts.Assembler != nil:
+		return errors.New("a Sink can't be combined with an Assembler")
+	case isFTPURL(downloadURL):
+		return fmt.Errorf("%s can't receive ftp downloads", kind)
+	case opts.OutputPath == StdoutOutputPath:
+		return fmt.Errorf("%s can't be combined with writing to stdout", kind)
+	}
+
+	if _, ok := assemblerSource(opts.sinkAssembler()); opts.checksum != nil && !ok {
+		return fmt.Errorf("verifying a checksum needs %s that implements io.ReaderAt", kind)
+	}
+
+	return nil
+}
+
+// sinkDownload fetches the contentLength bytes of a parallel download from
+// mirrors into opts.Sink or opts.Assembler and returns the number of bytes
+// transferred and of chunks.
+func sinkDownload(ctx context.Context, opts Options, contentLength uint64, mirrors []mirror) (uint64, int, error) {
+	if err := checkMaxSize(contentLength, opts); err != nil {
+		return 0, 0, err
+	}
+
+	if err := truncateSink(opts.Sink, contentLength); err != nil {
+		return 0, 0, err
+	}
+
+	progress := newProgressWriter(opts, contentLength)
+	chunks := planChunks(contentLength, opts.chunkStrategy())
+
+	progress.watchChunks(chunks)
+
+	asm := opts.sinkAssembler()
+
+	err := downloadChunks(ctx, opts, asm, progress, chunks, mirrors)
+	if err == nil {
+		err = asm.Finalize()
+	}
+
+	progress.finish()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	written := atomic.LoadUint64(&progress.readBytes)
+
+	return written, len(chunks), verifySink(opts, written)
+}
+
+// serialSinkDownload writes the body of res into opts.Sink or opts.Assembler
+// from offset zero on and returns the number of bytes transferred.
+func serialSinkDownload(ctx context.Context, res *http.Response, opts Options) (uint64, error) {
+	contentLength, _ := headerLength(res.Header, opts)
+
+	if err := checkMaxSize(contentLength, opts); err != nil {
+		return 0, err
+	}
+
+	if err := truncateSink(opts.Sink, contentLength); err != nil {
+		return 0, err
+	}
+
+	progress := newProgressWriter(opts, contentLength)
+
+	body := opts.limitReader(ctx, res.Body)
+
+	var bodyProgress io.Writer = progress
+
+	if encoding := res.Header.Get(contentEncodingHeader); opts.Decompress && isEncoded(encoding) {
+		var err error
+		if body, err = decodeBody(encoding, io.TeeReader(body, progress)); err != nil {
+			return 0, contextError(ctx, err)
+		}
+
+		bodyProgress = io.Discard
+	}
+
+	if opts.MaxSize > 0 && !opts.Force {
+		body = &maxSizeReader{reader: body, max: opts.MaxSize}
+	}
+
+	asm := opts.sinkAssembler()
+
+	// The whole body is a single range starting at offset zero, whose
+	// Written counts the bytes saved.
+	saved := &chunk{}
+
+	err := writeChunk(asm, saved, &contextReader{ctx: ctx, reader: body}, bodyProgress)
+	progress.finish()
+
+	written := atomic.LoadUint64(&progress.readBytes)
+
+	if err == nil && contentLength > 0 && written != contentLength {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err == nil {
+		err = asm.Finalize()
+	}
+
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	return written, verifySink(opts, saved.Written)
+}
+
+// truncateSink sizes sinks that support it, like files, before chunks are
+// written at their offsets.
+func truncateSink(sink io.WriterAt, size uint64) error {
+	if truncater, ok := sink.(interface{ Truncate(size int64) error }); ok {
+		return truncater.Truncate(int64(size))
+	}
+
+	return nil
+}
+
+// verifySink checks the first size bytes of opts.Sink or opts.Assembler
+// against the checksum, reading them back through io.ReaderAt.
+func verifySink(opts Options, size uint64) error {
+	if opts.checksum == nil {
+		return nil
+	}
+
+	src, ok := assemblerSource(opts.sinkAssembler())
+	if !ok {
+		return fmt.Errorf("verifying a checksum needs a Sink or Assembler that implements io.ReaderAt")
+	}
+
+	fmt.Fprintf(opts.progressOutput(), "\nVerifying %s checksum...", opts.checksum.algorithm)
+	opts.logger().Info("verifying checksum", "algorithm", opts.checksum.algorithm)
+
+	h := opts.checksum.newHash()
+	if _, err := io.Copy(h, io.NewSectionReader(src, 0, int64(size))); err != nil {
+		return err
+	}
+
+	return opts.checksum.verify(h)
+}
@@ -0,0 +1,103 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink is an in-memory io.WriterAt and io.ReaderAt.
+type memorySink struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (s *memorySink) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(s.data) {
+		s.data = append(s.data, make([]byte, end-len(s.data))...)
+	}
+
+	return copy(s.data[off:], p), nil
+}
+
+func (s *memorySink) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if off >= int64(len(s.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func TestDownloadToSink(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+
+	for _, acceptRanges := range []bool{true, false} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		dir := t.TempDir()
+		sink := &memorySink{}
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:         4,
+			Sink:           sink,
+			Checksum:       "sha256:" + hex.EncodeToString(sum[:]),
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Failed ranges %t: %v \n", acceptRanges, err)
+		}
+
+		if !bytes.Equal(sink.data, content) || result.Bytes != uint64(len(content)) || result.FileName != "" {
+			t.Errorf("Failed ranges %t: %d bytes in the sink, result %+v \n", acceptRanges, len(sink.data), result)
+		}
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Failed ranges %t: %d files written \n", acceptRanges, len(entries))
+		}
+	}
+}
+
+func TestDownloadToSinkRejectsChecksumWithoutReaderAt(t *testing.T) {
+	var sink struct{ io.WriterAt }
+
+	_, err := Download(context.Background(), "http://example.com/file.bin", Options{
+		Sink:           sink,
+		Checksum:       "md5:d41d8cd98f00b204e9800998ecf8427e",
+		ProgressOutput: io.Discard,
+	})
+	if err == nil {
+		t.Errorf("Failed download started without a way to verify the checksum \n")
+	}
+}
@@ -0,0 +1,311 @@
+package fastdownloader
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+// OpenStream downloads downloadURL without saving it and returns a reader
+// yielding its bytes in order, together with the size or -1 when unknown.
+// A server without range support is streamed straight from the response
+// body. Otherwise the chunks are downloaded in parallel into a temporary
+// spool file the reader follows; reads block until the next bytes have
+// arrived. Closing the reader stops the download and removes the spool file.
+func OpenStream(ctx context.Context, downloadURL string, opts Options) (io.ReadCloser, int64, error) {
+	opts, err := opts.prepare(downloadURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return openStream(ctx, downloadURL, opts)
+}
+
+// StdoutOutputPath as Options.OutputPath makes Download write to stdout.
+const StdoutOutputPath = "-"
+
+// downloadToStdout streams downloadURL to stdout in order, verifying the
+// checksum on the way, and returns the number of bytes written.
+func downloadToStdout(ctx context.Context, downloadURL string, opts Options) (uint64, error) {
+	stream, _, err := openStream(ctx, downloadURL, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		output io.Writer = os.Stdout
+		h      hash.Hash
+	)
+
+	if opts.checksum != nil {
+		h = opts.checksum.newHash()
+		output = io.MultiWriter(os.Stdout, h)
+	}
+
+	written, err := io.CopyBuffer(output, stream, make([]byte, opts.copyBufferSize()))
+
+	closeErr := stream.Close()
+
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+
+	if closeErr != nil {
+		return 0, closeErr
+	}
+
+	if h != nil {
+		if err := opts.checksum.verify(h); err != nil {
+			return 0, err
+		}
+	}
+
+	return uint64(written), nil
+}
+
+func openStream(ctx context.Context, downloadURL string, opts Options) (io.ReadCloser, int64, error) {
+	if isFTPURL(downloadURL) {
+		return openFTPStream(ctx, downloadURL, opts)
+	}
+
+	remote, err := probeRanges(ctx, downloadURL, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !remote.supportsParallel() {
+		return openSerialStream(ctx, downloadURL, opts)
+	}
+
+	mirrors, err := probeMirrors(ctx, remote, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	spool, err := os.CreateTemp(opts.TempDir, "fastdownloader-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The whole file passes through the spool, so it has to fit on disk.
+	err = checkSize(spool.Name(), remote.contentLength, remote.contentLength, opts)
+	if err == nil {
+		err = spool.Truncate(int64(remote.contentLength))
+	}
+
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Bytes are read from the spool as soon as they arrive, too early to
+	// take back a corrupt chunk.
+	opts.ChunkVerifier = nil
+
+	stream := &spoolReader{
+		file:     spool,
+		chunks:   planChunks(remote.contentLength, opts.chunkStrategy()),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		progress: newProgressWriter(opts, remote.contentLength),
+	}
+	stream.cond = sync.NewCond(&stream.mu)
+	stream.progress.watchChunks(stream.chunks)
+
+	go func() {
+		defer close(stream.done)
+
+		err := downloadChunks(ctx, opts, opts.fileAssembler(spool, false), stream, stream.chunks, mirrors)
+
+		stream.progress.finish()
+
+		if err != nil {
+			err = contextError(ctx, err)
+		}
+
+		stream.mu.Lock()
+		stream.err = err
+		stream.cond.Broadcast()
+		stream.mu.Unlock()
+	}()
+
+	return stream, int64(remote.contentLength), nil
+}
+
+func openSerialStream(ctx context.Context, downloadURL string, opts Options) (io.ReadCloser, int64, error) {
+	req, err := newRequest(ctx, http.MethodGet, downloadURL, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := opts.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, contextError(ctx, err)
+	}
+
+	if err := checkStatus(res); err != nil {
+		_ = res.Body.Close()
+
+		return nil, 0, err
+	}
+
+	if err := checkContentType(res.Header, opts); err != nil {
+		_ = res.Body.Close()
+
+		return nil, 0, err
+	}
+
+	size := res.ContentLength
+
+	var total uint64
+	if size > 0 {
+		total = uint64(size)
+	}
+
+	if err := checkMaxSize(total, opts); err != nil {
+		_ = res.Body.Close()
+
+		return nil, 0, err
+	}
+
+	progress := newProgressWriter(opts, total)
+
+	reader := io.TeeReader(opts.limitReader(ctx, res.Body), progress)
+
+	if encoding := res.Header.Get(contentEncodingHeader); opts.Decompress && isEncoded(encoding) {
+		reader, err = decodeBody(encoding, reader)
+		if err != nil {
+			_ = res.Body.Close()
+
+			return nil, 0, err
+		}
+
+		size = -1
+	}
+
+	if opts.MaxSize > 0 && !opts.Force {
+		reader = &maxSizeReader{reader: reader, max: opts.MaxSize}
+	}
+
+	body := struct {
+		io.Reader
+		io.Closer
+	}{reader, closerFunc(func() error {
+		progress.finish()
+
+		return res.Body.Close()
+	})}
+
+	return body, size, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// spoolReader reads a parallel download in order from the spool file its
+// chunks are written into. It doubles as the progress writer of the download
+// to learn when new bytes arrived.
+type spoolReader struct {
+	file     *os.File
+	chunks   []*chunk
+	progress *progressWriter
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	err    error
+	closed bool
+
+	index  int
+	offset uint64
+}
+
+func (s *spoolReader) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	return s.progress.Write(data)
+}
+
+func (s *spoolReader) Read(data []byte) (int, error) {
+	available, err := s.wait()
+	if err != nil {
+		return 0, err
+	}
+
+	if uint64(len(data)) > available {
+		data = data[:available]
+	}
+
+	n, err := s.file.ReadAt(data, int64(s.offset))
+	s.offset += uint64(n)
+
+	return n, err
+}
+
+// wait blocks until bytes at the read offset were written and returns how
+// many of them are contiguous.
+func (s *spoolReader) wait() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.closed {
+			return 0, errStreamClosed
+		}
+
+		if s.index == len(s.chunks) {
+			return 0, io.EOF
+		}
+
+		c := s.chunks[s.index]
+		if s.offset > c.Stop {
+			s.index++
+
+			continue
+		}
+
+		if written := c.Start + atomic.LoadUint64(&c.Written); written > s.offset {
+			return written - s.offset, nil
+		}
+
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		s.cond.Wait()
+	}
+}
+
+func (s *spoolReader) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.cancel()
+	<-s.done
+
+	err := s.file.Close()
+	if removeErr := os.Remove(s.file.Name()); err == nil {
+		err = removeErr
+	}
+
+	return err
+}
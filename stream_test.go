@@ -0,0 +1,197 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenStream(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	cases := []struct {
+		name         string
+		acceptRanges bool
+		expectedSize int64
+	}{
+		{"parallel", true, int64(len(content))},
+		{"serial", false, int64(len(content))},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			w.Header().Set("Content-Length", "65536")
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(content)
+			}
+		}))
+
+		stream, size, err := OpenStream(context.Background(), server.URL+"/file.bin", Options{
+			ParallelRequests: 3,
+			Chunks:           7,
+			HTTPClient:       server.Client(),
+			ProgressOutput:   io.Discard,
+		})
+		if err != nil {
+			server.Close()
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(stream)
+
+		_ = stream.Close()
+
+		server.Close()
+
+		if err != nil {
+			t.Errorf("Failed %s: %v \n", testCase.name, err)
+		}
+
+		if size != testCase.expectedSize {
+			t.Errorf("Failed %s: size %d, expected %d \n", testCase.name, size, testCase.expectedSize)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Failed %s: %d bytes streamed, expected %d \n", testCase.name, len(data), len(content))
+		}
+	}
+}
+
+func TestOpenStreamCloseStopsDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=500-999" {
+			// Stall the second chunk until the client gives up.
+			<-r.Context().Done()
+
+			return
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	stream, _, err := OpenStream(context.Background(), server.URL+"/file.bin", Options{
+		Chunks:         2,
+		HTTPClient:     server.Client(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 500)
+	if _, err := io.ReadFull(stream, data); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error)
+
+	go func() { closed <- stream.Close() }()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Failed %v \n", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Failed close didn't stop the download")
+	}
+
+	if _, err := stream.Read(data); err == nil {
+		t.Errorf("Failed read after close succeeded \n")
+	}
+}
+
+func TestDownloadToStdout(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+
+	cases := []struct {
+		acceptRanges bool
+		checksum     string
+		shouldFail   bool
+	}{
+		{true, "", false},
+		{false, "", false},
+		{true, "sha256:" + hex.EncodeToString(sum[:]), false},
+		{false, "sha256:" + strings.Repeat("00", 32), true},
+	}
+
+	for _, testCase := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if testCase.acceptRanges {
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+
+				return
+			}
+
+			_, _ = w.Write(content)
+		}))
+
+		stdoutReader, stdoutWriter, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stdoutResult := make(chan []byte, 1)
+
+		go func() {
+			data, _ := io.ReadAll(stdoutReader)
+			stdoutResult <- data
+		}()
+
+		stdout := os.Stdout
+		os.Stdout = stdoutWriter
+
+		dir := t.TempDir()
+
+		result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+			Chunks:         7,
+			OutputPath:     StdoutOutputPath,
+			OutputDir:      dir,
+			HTTPClient:     server.Client(),
+			Checksum:       testCase.checksum,
+			ProgressOutput: io.Discard,
+		})
+
+		os.Stdout = stdout
+
+		_ = stdoutWriter.Close()
+		data := <-stdoutResult
+
+		server.Close()
+
+		if (err != nil) != testCase.shouldFail {
+			t.Errorf("Failed %+v: unexpected error %v \n", testCase, err)
+		}
+
+		if !bytes.Equal(data, content) {
+			t.Errorf("Failed %+v: %d bytes on stdout, expected %d \n", testCase, len(data), len(content))
+		}
+
+		if err == nil && (result.FileName != StdoutOutputPath || result.Bytes != uint64(len(content))) {
+			t.Errorf("Failed %+v: unexpected result %+v \n", testCase, result)
+		}
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("Failed %+v: %d files written \n", testCase, len(entries))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package fastdownloader
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// templatePlaceholders are the placeholders of Options.OutputTemplate.
+var templatePlaceholders = []string{"name", "index", "host", "ext", "date"}
+
+// ValidateOutputTemplate checks an Options.OutputTemplate: its braces have to
+// enclose known placeholders and it can't contain path separators.
+func ValidateOutputTemplate(template string) error {
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("output template %q can't contain path separators", template)
+	}
+
+	for rest := template; ; {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			return nil
+		}
+
+		if rest[start] == '}' {
+			return fmt.Errorf("output template %q has an unmatched }", template)
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("output template %q has an unmatched {", template)
+		}
+
+		placeholder := rest[start+1 : start+end]
+		if !isTemplatePlaceholder(placeholder) {
+			return fmt.Errorf("unknown placeholder {%s} in output template %q, expected one of {%s}",
+				placeholder, template, strings.Join(templatePlaceholders, "}, {"))
+		}
+
+		rest = rest[start+end+1:]
+	}
+}
+
+func isTemplatePlaceholder(name string) bool {
+	for _, placeholder := range templatePlaceholders {
+		if name == placeholder {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandOutputTemplate names the download of fileName, resolved for
+// downloadURL, after opts.OutputTemplate. The template has been validated.
+func expandOutputTemplate(fileName, downloadURL string, opts Options, now time.Time) (string, error) {
+	if opts.OutputTemplate == "" {
+		return fileName, nil
+	}
+
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.NewReplacer(
+		"{name}", fileName,
+		"{index}", fmt.Sprintf("%03d", opts.OutputIndex),
+		"{host}", u.Hostname(),
+		"{ext}", filepath.Ext(fileName),
+		"{date}", now.Format("2006-01-02"),
+	).Replace(opts.OutputTemplate)
+
+	if sanitizeFileName(name) == "" {
+		return "", fmt.Errorf("output template %q gives %s the unusable name %q", opts.OutputTemplate, fileName, name)
+	}
+
+	return name, nil
+}
@@ -0,0 +1,108 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateOutputTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		invalid  string
+	}{
+		{"{index}-{name}", ""},
+		{"{host}_{date}{ext}", ""},
+		{"plain.bin", ""},
+		{"{title}{ext}", "unknown placeholder {title}"},
+		{"{Name}", "unknown placeholder {Name}"},
+		{"{index-{name}", "unknown placeholder {index-{name}"},
+		{"{name", "unmatched {"},
+		{"name}", "unmatched }"},
+		{"{host}/{name}", "path separators"},
+	}
+
+	for _, testCase := range cases {
+		err := ValidateOutputTemplate(testCase.template)
+
+		if testCase.invalid == "" && err != nil || testCase.invalid != "" && (err == nil || !strings.Contains(err.Error(), testCase.invalid)) {
+			t.Errorf("Failed %q: %v, expected %q \n", testCase.template, err, testCase.invalid)
+		}
+	}
+}
+
+func TestExpandOutputTemplate(t *testing.T) {
+	now := time.Date(2024, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	cases := []struct {
+		template string
+		fileName string
+		expected string
+	}{
+		{"", "file.zip", "file.zip"},
+		{"{name}", "file.zip", "file.zip"},
+		{"{index}", "file.zip", "007"},
+		{"{host}", "file.zip", "example.com"},
+		{"{ext}", "file.tar.gz", ".gz"},
+		{"{date}", "file.zip", "2024-03-04"},
+		{"{index}-{name}", "file.zip", "007-file.zip"},
+		{"{host}-{date}-{index}{ext}", "file.zip", "example.com-2024-03-04-007.zip"},
+		{"{name}{ext}", "README", "README"},
+	}
+
+	for _, testCase := range cases {
+		opts := Options{OutputTemplate: testCase.template, OutputIndex: 7}
+
+		fileName, err := expandOutputTemplate(testCase.fileName, "https://example.com:8443/dl/"+testCase.fileName, opts, now)
+		if err != nil || fileName != testCase.expected {
+			t.Errorf("Failed %q: %q, %v, expected %q \n", testCase.template, fileName, err, testCase.expected)
+		}
+	}
+
+	// A template can leave nothing of a name.
+	if _, err := expandOutputTemplate("README", "https://example.com/README", Options{OutputTemplate: "{ext}"}, now); err == nil {
+		t.Errorf("Failed an empty name was accepted \n")
+	}
+}
+
+func TestDownloadOutputTemplate(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	for index := 1; index <= 2; index++ {
+		result, err := Download(context.Background(), server.URL+"/file.zip", Options{
+			OutputTemplate: "{index}-{name}",
+			OutputIndex:    index,
+			OutputDir:      dir,
+			ProgressOutput: io.Discard,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := filepath.Join(dir, fmt.Sprintf("%03d-file.zip", index)); result.FileName != expected {
+			t.Errorf("Failed %s, expected %s \n", result.FileName, expected)
+		}
+	}
+
+	if _, err := Download(context.Background(), server.URL+"/file.zip", Options{
+		OutputTemplate: "{title}",
+		OutputDir:      dir,
+		ProgressOutput: io.Discard,
+	}); err == nil || !strings.Contains(err.Error(), "unknown placeholder") {
+		t.Errorf("Failed an unknown placeholder: %v \n", err)
+	}
+}
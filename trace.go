@@ -0,0 +1,163 @@
+package fastdownloader
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// TraceSummary aggregates the time to first byte of the requests of a
+// download traced with Options.Trace.
+type TraceSummary struct {
+	Requests int
+
+	MinTTFB  time.Duration
+	MeanTTFB time.Duration
+	MaxTTFB  time.Duration
+}
+
+// String summarizes the requests, e.g. "TTFB of 9 requests: min 12ms, mean
+// 20ms, max 41ms".
+func (s *TraceSummary) String() string {
+	return fmt.Sprintf(
+		"TTFB of %d requests: min %s, mean %s, max %s",
+		s.Requests,
+		s.MinTTFB.Round(time.Millisecond),
+		s.MeanTTFB.Round(time.Millisecond),
+		s.MaxTTFB.Round(time.Millisecond),
+	)
+}
+
+// traceStats collects the time to first byte of every traced request of a
+// download, from all its chunks.
+type traceStats struct {
+	mu   sync.Mutex
+	ttfb []time.Duration
+}
+
+func (s *traceStats) add(ttfb time.Duration) {
+	s.mu.Lock()
+	s.ttfb = append(s.ttfb, ttfb)
+	s.mu.Unlock()
+}
+
+// summary returns nil when nothing was traced.
+func (s *traceStats) summary() *TraceSummary {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.ttfb) == 0 {
+		return nil
+	}
+
+	summary := &TraceSummary{Requests: len(s.ttfb), MinTTFB: s.ttfb[0], MaxTTFB: s.ttfb[0]}
+
+	var total time.Duration
+
+	for _, ttfb := range s.ttfb {
+		total += ttfb
+		summary.MinTTFB = min(summary.MinTTFB, ttfb)
+		summary.MaxTTFB = max(summary.MaxTTFB, ttfb)
+	}
+
+	summary.MeanTTFB = total / time.Duration(len(s.ttfb))
+
+	return summary
+}
+
+// requestTrace times the phases of a request. The callbacks of concurrent
+// dials may overlap, hence the lock.
+type requestTrace struct {
+	mu sync.Mutex
+	requestTimes
+}
+
+// requestTimes are reset for every response of a redirect chain.
+type requestTimes struct {
+	start, dnsStart, connectStart, tlsStart time.Time
+	dns, connect, tlsHandshake              time.Duration
+	reused                                  bool
+}
+
+// withTrace attaches a trace to the request for url that is sent with ctx.
+// Every response, including redirects, logs its phase durations at debug
+// level and adds its time to first byte, counted from getting a connection,
+// to opts.traces.
+func withTrace(ctx context.Context, method, url string, opts Options) context.Context {
+	t := &requestTrace{}
+
+	since := func(start time.Time) time.Duration {
+		if start.IsZero() {
+			return 0
+		}
+
+		return time.Since(start)
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.requestTimes = requestTimes{start: time.Now()}
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			t.connectStart = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.connect = since(t.connectStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tlsHandshake = since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			ttfb := since(t.start)
+
+			opts.logger().Debug("request timing",
+				"method", method,
+				"url", url,
+				"reused", t.reused,
+				"dns", t.dns,
+				"connect", t.connect,
+				"tls", t.tlsHandshake,
+				"ttfb", ttfb,
+			)
+			t.mu.Unlock()
+
+			opts.traces.add(ttfb)
+		},
+	})
+}
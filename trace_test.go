@@ -0,0 +1,84 @@
+package fastdownloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadTrace(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		HTTPClient:     server.Client(),
+		Chunks:         4,
+		Trace:          true,
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+		Logger:         slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	var timings, handshakes int
+
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if !strings.Contains(line, `msg="request timing"`) {
+			continue
+		}
+
+		timings++
+
+		if !strings.Contains(line, " tls=0s") {
+			handshakes++
+		}
+	}
+
+	// The probe and the four chunks at least, some of them on new
+	// connections.
+	if timings < 5 || handshakes == 0 {
+		t.Errorf("Failed logged %d timings, %d with a TLS handshake: \n%s", timings, handshakes, logs.String())
+	}
+
+	summary := result.Trace
+	if summary == nil || summary.Requests != timings {
+		t.Fatalf("Failed summary %+v, expected %d requests \n", summary, timings)
+	}
+
+	if summary.MinTTFB <= 0 || summary.MinTTFB > summary.MeanTTFB || summary.MeanTTFB > summary.MaxTTFB {
+		t.Errorf("Failed summary %+v \n", summary)
+	}
+}
+
+func TestDownloadWithoutTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	result, err := Download(context.Background(), server.URL+"/file.bin", Options{
+		OutputDir:      t.TempDir(),
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed %v \n", err)
+	}
+
+	if result.Trace != nil {
+		t.Errorf("Failed summary %+v without Trace \n", result.Trace)
+	}
+}
@@ -0,0 +1,188 @@
+package fastdownloader
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultResponseHeaderTimeout is the default of
+// Options.ResponseHeaderTimeout. It is generous, since some servers only
+// answer once they prepared the file.
+const DefaultResponseHeaderTimeout = time.Minute
+
+const (
+	defaultKeepAlive = 30 * time.Second
+
+	// defaultConnectTimeout matches the dialer of http.DefaultTransport.
+	defaultConnectTimeout = 30 * time.Second
+)
+
+// dialFunc opens a connection like net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// newHTTPClient builds the client used for a download when Options.HTTPClient
+// isn't set. It is created once per download so chunk requests share its
+// connection pool.
+func newHTTPClient(opts Options) (*http.Client, error) {
+	dial, err := newDialFunc(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// Every worker keeps its connection alive between chunks; the default of
+	// two idle connections per host would close the rest after each chunk.
+	// Workers move between the mirrors, so each host may need them all.
+	if idle := int(opts.ParallelRequests); idle > transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConnsPerHost = idle
+	}
+
+	if idle := transport.MaxIdleConnsPerHost * (1 + len(opts.Mirrors)); idle > transport.MaxIdleConns {
+		transport.MaxIdleConns = idle
+	}
+
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+
+	transport.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	if opts.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	}
+
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+
+	// A non-nil empty TLSNextProto keeps the transport from upgrading TLS
+	// connections to HTTP/2.
+	if opts.HTTP1 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if opts.Proxy != "" {
+		proxyURL, err := parseProxyURL(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig.Clone()
+	}
+
+	if opts.ConnectTimeout > 0 || opts.IPVersion != 0 || opts.BindAddress != "" {
+		transport.DialContext = dial
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// newDialFunc returns the dial function of every connection a download opens
+// itself, honoring ConnectTimeout, IPVersion and BindAddress.
+func newDialFunc(opts Options) (dialFunc, error) {
+	if err := checkIPVersion(opts.IPVersion); err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   defaultConnectTimeout,
+		KeepAlive: defaultKeepAlive,
+	}
+
+	if opts.ConnectTimeout > 0 {
+		dialer.Timeout = opts.ConnectTimeout
+	}
+
+	if opts.BindAddress != "" {
+		localAddr, err := bindAddress(opts.BindAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		dialer.LocalAddr = localAddr
+	}
+
+	return restrictNetwork(dialer.DialContext, opts.IPVersion), nil
+}
+
+// bindAddress validates a local IP address to connect from by binding a
+// socket to it, so a typo or an interface that is down fails the download up
+// front instead of every connection.
+func bindAddress(address string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid bind address %q, expected an IP address", address)
+	}
+
+	localAddr := &net.TCPAddr{IP: ip}
+
+	listener, err := net.ListenTCP("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("can't bind to %s: %w", address, err)
+	}
+
+	_ = listener.Close()
+
+	return localAddr, nil
+}
+
+// restrictNetwork makes dial connect over IPv4 or IPv6 only, as ipVersion
+// asks, or leaves it alone when ipVersion is zero.
+func restrictNetwork(dial dialFunc, ipVersion int) dialFunc {
+	if ipVersion == 0 {
+		return dial
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+			network = fmt.Sprintf("tcp%d", ipVersion)
+		}
+
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to %s over IPv%d failed: %w", address, ipVersion, err)
+		}
+
+		return conn, nil
+	}
+}
+
+// checkIPVersion validates Options.IPVersion.
+func checkIPVersion(ipVersion int) error {
+	switch ipVersion {
+	case 0, 4, 6:
+		return nil
+	}
+
+	return fmt.Errorf("invalid IP version %d, expected 4, 6 or 0 for either", ipVersion)
+}
+
+// parseProxyURL validates a proxy URL. net/http speaks both HTTP(S) and SOCKS5
+// proxies natively, including user:pass@ credentials.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+
+	return proxyURL, nil
+}